@@ -10,12 +10,11 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	amqp "github.com/rabbitmq/amqp091-go"
 	redisclient "github.com/redis/go-redis/v9"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
 	mongoadapter "github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
-	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/rabbit"
 	redisadapter "github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/redis"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/auth"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/config"
 	httphandler "github.com/robertarktes/ticket-reservations-and-orders/internal/http"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
@@ -45,7 +44,11 @@ func main() {
 		log.Fatalf("failed to connect to crdb: %v", err)
 	}
 	defer pool.Close()
-	crdbRepo := crdb.NewRepository(pool)
+	crdbRepo := crdb.NewRepository(pool, crdb.RetryPolicy{
+		MaxAttempts: cfg.TxMaxAttempts,
+		BaseDelay:   cfg.TxRetryBaseDelay,
+		MaxDelay:    cfg.TxRetryMaxDelay,
+	})
 
 	mongoClient, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.MongoURI))
 	if err != nil {
@@ -54,31 +57,47 @@ func main() {
 	defer mongoClient.Disconnect(context.Background())
 	mongoDB := mongoClient.Database("tro")
 	mongoCatalog := mongoadapter.NewCatalogRepository(mongoDB, logger)
+	indexCtx, cancelIndex := context.WithTimeout(context.Background(), 30*time.Second)
+	err = mongoCatalog.EnsureIndexes(indexCtx)
+	cancelIndex()
+	if err != nil {
+		log.Fatalf("failed to create catalog indexes: %v", err)
+	}
+	auditLogger := mongoadapter.NewAuditLogger(mongoDB, logger)
 
 	redisClient := redisclient.NewClient(&redisclient.Options{Addr: cfg.RedisAddr})
 	redisCache := redisadapter.NewCache(redisClient)
 	redisIdemp := redisadapter.NewIdempotency(redisClient)
-	idemp := idempotency.NewIdempotency(redisIdemp, time.Hour)
+	idemp := idempotency.NewIdempotency(redisIdemp, crdb.NewIdempotencyStore(pool), time.Hour)
 	rl := rateLimit.NewRateLimiter(redisCache)
 
-	rabbitConn, err := amqp.Dial(cfg.RabbitURL)
+	verifier, err := auth.NewVerifier(auth.Options{
+		PublicKey: cfg.JWTPublicKey,
+		JWKSFile:  cfg.JWTJWKSFile,
+		Issuer:    cfg.JWTIssuer,
+		Audience:  cfg.JWTAudience,
+		Leeway:    30 * time.Second,
+	})
 	if err != nil {
-		log.Fatalf("failed to connect to rabbitmq: %v", err)
-	}
-	defer rabbitConn.Close()
-	rabbitPub, err := rabbit.NewPublisher(rabbitConn)
-	if err != nil {
-		log.Fatalf("failed to create publisher: %v", err)
+		log.Fatalf("failed to setup jwt verifier: %v", err)
 	}
 
-	handlers := httphandler.NewHandlers(cfg, crdbRepo, redisCache, idemp, mongoCatalog, rabbitPub)
+	hub := httphandler.NewAvailabilityHub(crdbRepo, logger)
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	defer stopHub()
+	go hub.Run(hubCtx)
+
+	handlers := httphandler.NewHandlers(cfg, crdbRepo, redisCache, mongoCatalog, auditLogger, hub)
 
-	r := httphandler.SetupRouter(handlers, logger, rl, idemp)
+	r := httphandler.SetupRouter(handlers, logger, verifier, rl, idemp)
 
 	srv := &http.Server{
 		Addr:    ":8080",
 		Handler: r,
 	}
+	// Availability streams never finish on their own; ending the hub closes
+	// them so Shutdown does not wait for its deadline.
+	srv.RegisterOnShutdown(stopHub)
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
+	mongoadapter "github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/config"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/outbox"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The catalog projector keeps seat availability in the Mongo catalog in line
+// with CockroachDB, which owns the seat inventory, and reports drift between
+// the two.
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	shutdownOtel, err := observability.SetupOTel(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("failed to setup otel: %v", err)
+	}
+	defer shutdownOtel()
+
+	logger := observability.NewLogger()
+	observability.InitMetrics()
+
+	pool, err := pgxpool.New(context.Background(), cfg.CRDBDSN)
+	if err != nil {
+		log.Fatalf("failed to connect to crdb: %v", err)
+	}
+	defer pool.Close()
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{
+		MaxAttempts: cfg.TxMaxAttempts,
+		BaseDelay:   cfg.TxRetryBaseDelay,
+		MaxDelay:    cfg.TxRetryMaxDelay,
+	})
+
+	mongoClient, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.MongoURI))
+	if err != nil {
+		log.Fatalf("failed to connect to mongo: %v", err)
+	}
+	defer mongoClient.Disconnect(context.Background())
+	catalog := mongoadapter.NewCatalogRepository(mongoClient.Database("tro"), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go outbox.NewProjector(repo, catalog, logger).Run(ctx)
+	go outbox.NewReconciler(repo, catalog, logger).Run(ctx, cfg.CatalogReconcileInterval)
+
+	metrics := &http.Server{Addr: cfg.MetricsAddr, Handler: promhttp.Handler()}
+	go func() {
+		if err := metrics.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server failed", err)
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+	metrics.Shutdown(context.Background())
+	logger.Info("Shutdown catalog projector")
+}
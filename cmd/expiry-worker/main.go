@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -10,18 +10,20 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	amqp "github.com/rabbitmq/amqp091-go"
 	redisclient "github.com/redis/go-redis/v9"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
-	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/rabbit"
 	redisadapter "github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/redis"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/config"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
 )
 
+// lapsedOrderBatch bounds the orders expired per tick; the rest are picked
+// up by the next one.
+const lapsedOrderBatch = 500
+
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
@@ -41,22 +43,16 @@ func main() {
 		log.Fatalf("failed to connect to crdb: %v", err)
 	}
 	defer pool.Close()
-	repo := crdb.NewRepository(pool)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{
+		MaxAttempts: cfg.TxMaxAttempts,
+		BaseDelay:   cfg.TxRetryBaseDelay,
+		MaxDelay:    cfg.TxRetryMaxDelay,
+	})
 
 	redisClient := redisclient.NewClient(&redisclient.Options{Addr: cfg.RedisAddr})
 	redisCache := redisadapter.NewCache(redisClient)
 
-	conn, err := amqp.Dial(cfg.RabbitURL)
-	if err != nil {
-		log.Fatalf("failed to connect to rabbitmq: %v", err)
-	}
-	defer conn.Close()
-	rabbitPub, err := rabbit.NewPublisher(conn)
-	if err != nil {
-		log.Fatalf("failed to create publisher: %v", err)
-	}
-
-	worker := NewExpiryWorker(repo, redisCache, rabbitPub, logger)
+	worker := NewExpiryWorker(repo, redisCache, logger, cfg.PaymentTimeout)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -69,15 +65,18 @@ func main() {
 	logger.Info("Shutdown expiry worker")
 }
 
+// ExpiryWorker expires lapsed holds and orders that were not paid
+// within paymentTimeout. hold.expired and order.expired are written to the
+// outbox in the expiring transaction and published by the outbox publisher.
 type ExpiryWorker struct {
-	repo      *crdb.Repository
-	redis     *redisadapter.Cache
-	rabbitPub *rabbit.Publisher
-	logger    observability.Logger
+	repo           *crdb.Repository
+	redis          *redisadapter.Cache
+	logger         observability.Logger
+	paymentTimeout time.Duration
 }
 
-func NewExpiryWorker(repo *crdb.Repository, redis *redisadapter.Cache, rabbitPub *rabbit.Publisher, logger observability.Logger) *ExpiryWorker {
-	return &ExpiryWorker{repo: repo, redis: redis, rabbitPub: rabbitPub, logger: logger}
+func NewExpiryWorker(repo *crdb.Repository, redis *redisadapter.Cache, logger observability.Logger, paymentTimeout time.Duration) *ExpiryWorker {
+	return &ExpiryWorker{repo: repo, redis: redis, logger: logger, paymentTimeout: paymentTimeout}
 }
 
 func (w *ExpiryWorker) Run(ctx context.Context, interval time.Duration) {
@@ -99,6 +98,28 @@ func (w *ExpiryWorker) Run(ctx context.Context, interval time.Duration) {
 					w.logger.Error("failed to process expired hold after retries", err)
 				}
 			}
+			w.expireLapsedOrders(ctx, now)
+		}
+	}
+}
+
+// expireLapsedOrders expires the orders that have been awaiting payment for
+// longer than the payment timeout, which puts their seats and admissions back
+// on sale. An order paid for in the meantime is left alone: the transition
+// from CONFIRMED is refused.
+func (w *ExpiryWorker) expireLapsedOrders(ctx context.Context, now time.Time) {
+	orderIDs, err := w.repo.GetLapsedOrders(ctx, now.Add(-w.paymentTimeout), lapsedOrderBatch)
+	if err != nil {
+		w.logger.Error("failed to get lapsed orders", err)
+		return
+	}
+	for _, orderID := range orderIDs {
+		err := w.repo.WithTx(ctx, func(tx pgx.Tx) error {
+			_, err := w.repo.TransitionOrder(ctx, tx, orderID, domain.OrderExpired, "payment timed out")
+			return err
+		})
+		if err != nil && !errors.Is(err, domain.ErrConflict) {
+			w.logger.WithField("order_id", orderID).Error("failed to expire order", err)
 		}
 	}
 }
@@ -106,7 +127,12 @@ func (w *ExpiryWorker) Run(ctx context.Context, interval time.Duration) {
 func (w *ExpiryWorker) processExpiredHoldWithRetry(ctx context.Context, hold domain.Hold) error {
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		err := w.repo.ReleaseHold(ctx, hold.ID)
+		err := w.repo.WithTx(ctx, func(tx pgx.Tx) error {
+			return w.repo.ExpireHold(ctx, tx, hold.ID)
+		})
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil
+		}
 		if err != nil {
 			backoff := time.Duration(1<<i) * time.Second
 			select {
@@ -117,18 +143,8 @@ func (w *ExpiryWorker) processExpiredHoldWithRetry(ctx context.Context, hold dom
 			}
 		}
 
-		for _, seat := range hold.Seats {
-			redisClient := redisclient.NewClient(&redisclient.Options{Addr: "localhost:6379"})
-			redisClient.Del(ctx, "hold:"+hold.EventID.String()+":"+seat)
-		}
-
-		payload, _ := json.Marshal(map[string]interface{}{"hold_id": hold.ID})
-		msg := amqp.Publishing{
-			MessageId:   uuid.New().String(),
-			ContentType: "application/json",
-			Body:        payload,
-		}
-		return w.rabbitPub.Publish(ctx, "hold.expired", msg)
+		w.redis.ReleaseHoldLocks(ctx, hold.EventID.String(), hold.Seats, hold.ID.String())
+		return nil
 	}
 	return fmt.Errorf("failed after %d retries", maxRetries)
 }
@@ -36,7 +36,11 @@ func main() {
 		log.Fatalf("failed to connect to crdb: %v", err)
 	}
 	defer pool.Close()
-	repo := crdb.NewRepository(pool)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{
+		MaxAttempts: cfg.TxMaxAttempts,
+		BaseDelay:   cfg.TxRetryBaseDelay,
+		MaxDelay:    cfg.TxRetryMaxDelay,
+	})
 
 	conn, err := amqp.Dial(cfg.RabbitURL)
 	if err != nil {
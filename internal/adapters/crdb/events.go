@@ -0,0 +1,246 @@
+package crdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+// SaveEvent creates event, or updates its title, start, seats and pools,
+// keeping the stored status, which it returns. Updating a cancelled event is
+// a conflict, and so is dropping a seat or pool that is still held or sold;
+// the latter fails with a SeatsUnavailableError or PoolsUnavailableError
+// listing them. A dropped seat or pool that past holds or orders refer to is
+// kept as unsellable.
+func (r *Repository) SaveEvent(ctx context.Context, tx pgx.Tx, event domain.Event) (domain.EventStatus, error) {
+	var status domain.EventStatus
+	err := tx.QueryRow(ctx, `
+		INSERT INTO events (id, title, starts_at, status) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET title = excluded.title, starts_at = excluded.starts_at, updated_at = now()
+		RETURNING status
+	`, event.ID, event.Title, event.StartsAt, event.Status).Scan(&status)
+	if err != nil {
+		return "", err
+	}
+	if status == domain.EventCancelled {
+		return status, fmt.Errorf("%w: event is cancelled", domain.ErrConflict)
+	}
+	if err := saveInventory(ctx, tx, event); err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// CreateEvent inserts event with its seats and pools and reports true. An
+// existing event with the same id is never overwritten: if it has the same
+// title, start, seats and pools, as when a create is repeated, CreateEvent
+// reports false with its stored status, and otherwise it fails with
+// domain.ErrEventExists.
+func (r *Repository) CreateEvent(ctx context.Context, tx pgx.Tx, event domain.Event) (domain.EventStatus, bool, error) {
+	rows, err := tx.Query(ctx, `
+		INSERT INTO events (id, title, starts_at, status) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING status
+	`, event.ID, event.Title, event.StartsAt, event.Status)
+	if err != nil {
+		return "", false, err
+	}
+	inserted, err := pgx.CollectRows(rows, pgx.RowTo[domain.EventStatus])
+	if err != nil {
+		return "", false, err
+	}
+	if len(inserted) == 1 {
+		return inserted[0], true, saveInventory(ctx, tx, event)
+	}
+
+	status, same, err := sameEvent(ctx, tx, event)
+	if err != nil {
+		return "", false, err
+	}
+	if !same {
+		return "", false, domain.ErrEventExists
+	}
+	return status, false, nil
+}
+
+// sameEvent reports whether the stored event with event's id has its title,
+// start, seats and pools, and returns the stored status.
+func sameEvent(ctx context.Context, tx pgx.Tx, event domain.Event) (domain.EventStatus, bool, error) {
+	var status domain.EventStatus
+	var same bool
+	err := tx.QueryRow(ctx, `
+		SELECT status, title = $2 AND starts_at = $3 FROM events WHERE id = $1
+	`, event.ID, event.Title, event.StartsAt).Scan(&status, &same)
+	if err != nil || !same {
+		return status, false, err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT seat_no, sellable FROM seats WHERE event_id = $1`, event.ID)
+	if err != nil {
+		return "", false, err
+	}
+	seats, err := pgx.CollectRows(rows, pgx.RowToStructByPos[domain.EventSeat])
+	if err != nil {
+		return "", false, err
+	}
+	rows, err = tx.Query(ctx, `SELECT pool_id, capacity, sellable FROM pools WHERE event_id = $1`, event.ID)
+	if err != nil {
+		return "", false, err
+	}
+	pools, err := pgx.CollectRows(rows, pgx.RowToStructByPos[domain.EventPool])
+	if err != nil {
+		return "", false, err
+	}
+	return status, sameElements(seats, event.Seats) && sameElements(pools, event.Pools), nil
+}
+
+// sameElements reports whether a and b hold the same elements in any order.
+func sameElements[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[T]int{}
+	for _, v := range a {
+		counts[v]++
+	}
+	for _, v := range b {
+		if counts[v] == 0 {
+			return false
+		}
+		counts[v]--
+	}
+	return true
+}
+
+// saveInventory makes the seats and pools of the stored event those of
+// event, as described on SaveEvent.
+func saveInventory(ctx context.Context, tx pgx.Tx, event domain.Event) error {
+	seatNos := make([]string, len(event.Seats))
+	sellable := make([]bool, len(event.Seats))
+	for i, seat := range event.Seats {
+		seatNos[i], sellable[i] = seat.SeatNo, seat.Sellable
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT seat_no FROM holds
+		WHERE event_id = $1 AND status = 'ACTIVE' AND expires_at > now() AND seat_no <> ALL($2::STRING[])
+		UNION
+		SELECT i.seat_no FROM order_items i JOIN orders o ON o.id = i.order_id
+		WHERE i.event_id = $1 AND o.status IN ('PENDING', 'AWAITING_PAYMENT', 'CONFIRMED')
+			AND i.seat_no <> ALL($2::STRING[])
+		ORDER BY seat_no
+	`, event.ID, seatNos)
+	if err != nil {
+		return err
+	}
+	taken, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	if len(taken) > 0 {
+		return &domain.SeatsUnavailableError{Seats: taken}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM seats s WHERE s.event_id = $1 AND s.seat_no <> ALL($2::STRING[])
+			AND NOT EXISTS (SELECT 1 FROM holds h WHERE h.event_id = s.event_id AND h.seat_no = s.seat_no)
+			AND NOT EXISTS (SELECT 1 FROM order_items i WHERE i.event_id = s.event_id AND i.seat_no = s.seat_no)
+	`, event.ID, seatNos); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE seats SET sellable = false WHERE event_id = $1 AND seat_no <> ALL($2::STRING[]) AND sellable
+	`, event.ID, seatNos); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO seats (event_id, seat_no, sellable)
+		SELECT $1, t.seat_no, t.sellable FROM unnest($2::STRING[], $3::BOOL[]) AS t (seat_no, sellable)
+		ON CONFLICT (event_id, seat_no) DO UPDATE SET sellable = excluded.sellable
+	`, event.ID, seatNos, sellable); err != nil {
+		return err
+	}
+	return savePools(ctx, tx, event)
+}
+
+// GetSeatInventory returns every seat CockroachDB has for an event, mapped
+// to whether it is sellable.
+func (r *Repository) GetSeatInventory(ctx context.Context, eventID uuid.UUID) (map[string]bool, error) {
+	rows, err := r.pool.Query(ctx, `SELECT seat_no, sellable FROM seats WHERE event_id = $1`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inventory := map[string]bool{}
+	for rows.Next() {
+		var seat string
+		var sellable bool
+		if err := rows.Scan(&seat, &sellable); err != nil {
+			return nil, err
+		}
+		inventory[seat] = sellable
+	}
+	return inventory, rows.Err()
+}
+
+// GetEventIDs pages through all events in id order, starting after `after`.
+func (r *Repository) GetEventIDs(ctx context.Context, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	rows, err := r.pool.Query(ctx, `SELECT id FROM events WHERE id > $1 ORDER BY id LIMIT $2`, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+// TransitionEvent moves an event to status `to` if the state machine allows
+// it and records an outbox event in the same transaction. An event already
+// in `to` is left as it is, so a transition can be repeated.
+func (r *Repository) TransitionEvent(ctx context.Context, tx pgx.Tx, eventID uuid.UUID, to domain.EventStatus) error {
+	var from domain.EventStatus
+	err := tx.QueryRow(ctx, `SELECT status FROM events WHERE id = $1 FOR UPDATE`, eventID).Scan(&from)
+	if err == pgx.ErrNoRows {
+		return domain.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if err := domain.ValidateEventTransition(from, to); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE events SET status = $2, updated_at = now() WHERE id = $1
+	`, eventID, to); err != nil {
+		return err
+	}
+	return r.InsertOutbox(ctx, tx, EventOutboxRecord(eventID, to, eventTransitionTypes[to]))
+}
+
+var eventTransitionTypes = map[domain.EventStatus]string{
+	domain.EventPublished: "event.published",
+	domain.EventDraft:     "event.unpublished",
+	domain.EventCancelled: "event.cancelled",
+}
+
+// EventOutboxRecord announces a change to an event's details or status.
+func EventOutboxRecord(eventID uuid.UUID, status domain.EventStatus, eventType string) OutboxRecord {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"event_id": eventID,
+		"status":   status,
+	})
+	return OutboxRecord{
+		ID:            uuid.New(),
+		AggregateType: "event",
+		AggregateID:   eventID,
+		EventType:     eventType,
+		Payload:       payload,
+		DedupeKey:     uuid.New().String(),
+	}
+}
@@ -0,0 +1,114 @@
+package crdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
+)
+
+// IdempotencyStore is the durable idempotency.Store. Besides the Store
+// methods, WithTx records the request's claim in the business transaction
+// (see claimIdempotencyKey), so the key and the write commit together.
+type IdempotencyStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewIdempotencyStore(pool *pgxpool.Pool) *IdempotencyStore {
+	return &IdempotencyStore{pool: pool}
+}
+
+func (s *IdempotencyStore) Get(ctx context.Context, key string) (*idempotency.Record, error) {
+	var (
+		rec      idempotency.Record
+		token    *string
+		status   *int
+		header   []byte
+		location *string
+	)
+	err := s.pool.QueryRow(ctx, `
+		SELECT fingerprint, token, status, header, body, committed, location FROM idempotency_keys
+		WHERE key = $1 AND expires_at > now()
+	`, key).Scan(&rec.Fingerprint, &token, &status, &header, &rec.Result, &rec.Committed, &location)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token != nil {
+		rec.Token = *token
+	}
+	if status != nil {
+		rec.Status = *status
+	}
+	if location != nil {
+		rec.Location = *location
+	}
+	if header != nil {
+		if err := json.Unmarshal(header, &rec.Header); err != nil {
+			return nil, err
+		}
+	}
+	return &rec, nil
+}
+
+func (s *IdempotencyStore) Reserve(ctx context.Context, key string, rec idempotency.Record, ttl time.Duration) (bool, error) {
+	result, err := s.pool.Exec(ctx, `
+		INSERT INTO idempotency_keys (key, fingerprint, token, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE
+		SET fingerprint = excluded.fingerprint, token = excluded.token, committed = false,
+			status = NULL, header = NULL, body = NULL, location = NULL, expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at <= now()
+	`, key, rec.Fingerprint, rec.Token, time.Now().Add(ttl))
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (s *IdempotencyStore) Set(ctx context.Context, key string, rec idempotency.Record, ttl time.Duration) error {
+	header, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, `
+		UPSERT INTO idempotency_keys (key, fingerprint, token, committed, status, header, body, location, expires_at)
+		VALUES ($1, $2, NULL, true, $3, $4, $5, NULL, $6)
+	`, key, rec.Fingerprint, rec.Status, header, rec.Result, time.Now().Add(ttl))
+	return err
+}
+
+// Release keeps committed rows: once the guarded write is durable the key
+// must never be reusable, even if the response was lost.
+func (s *IdempotencyStore) Release(ctx context.Context, key, token string) error {
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM idempotency_keys WHERE key = $1 AND token = $2 AND NOT committed
+	`, key, token)
+	return err
+}
+
+// claimIdempotencyKey marks the claim committed inside tx, with its
+// location. It fails with ErrConflict if another request already committed
+// under the same key, which rolls back the duplicate write.
+func claimIdempotencyKey(ctx context.Context, tx pgx.Tx, claim *idempotency.Claim) error {
+	result, err := tx.Exec(ctx, `
+		INSERT INTO idempotency_keys (key, fingerprint, token, committed, location, expires_at) VALUES ($1, $2, $3, true, NULLIF($4, ''), $5)
+		ON CONFLICT (key) DO UPDATE
+		SET fingerprint = excluded.fingerprint, token = excluded.token, committed = true,
+			status = NULL, header = NULL, body = NULL, location = excluded.location, expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at <= now() OR idempotency_keys.token = excluded.token
+	`, claim.Key, claim.Fingerprint, claim.Token, claim.Location, time.Now().Add(claim.TTL))
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("%w: idempotency key %q already committed", domain.ErrConflict, claim.Key)
+	}
+	return nil
+}
@@ -2,10 +2,12 @@ package crdb
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
 )
 
 type OutboxRecord struct {
@@ -20,6 +22,37 @@ type OutboxRecord struct {
 	DedupeKey     string
 }
 
+// HoldOutboxRecord announces a change to hold. The payload carries the event,
+// seats and pool admissions so consumers can follow availability without a
+// lookup.
+func HoldOutboxRecord(hold domain.Hold, eventType string) OutboxRecord {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"hold_id":    hold.ID,
+		"event_id":   hold.EventID,
+		"seats":      hold.Seats,
+		"pools":      poolsPayload(hold.Pools),
+		"status":     hold.Status,
+		"expires_at": hold.ExpiresAt.Format(time.RFC3339),
+	})
+	return OutboxRecord{
+		ID:            uuid.New(),
+		AggregateType: "hold",
+		AggregateID:   hold.ID,
+		EventType:     eventType,
+		Payload:       payload,
+		DedupeKey:     uuid.New().String(),
+	}
+}
+
+// poolsPayload renders pool admissions for outbox payloads.
+func poolsPayload(pools []domain.PoolQuantity) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(pools))
+	for i, p := range pools {
+		out[i] = map[string]interface{}{"pool": p.Pool, "quantity": p.Quantity}
+	}
+	return out
+}
+
 func (r *Repository) InsertOutbox(ctx context.Context, tx pgx.Tx, record OutboxRecord) error {
 	_, err := tx.Exec(ctx, `
 		INSERT INTO outbox (id, aggregate_type, aggregate_id, event_type, payload_json, status, dedupe_key)
@@ -28,16 +61,64 @@ func (r *Repository) InsertOutbox(ctx context.Context, tx pgx.Tx, record OutboxR
 	return err
 }
 
+const outboxColumns = `id, aggregate_type, aggregate_id, event_type, payload_json, created_at, published_at, status, dedupe_key`
+
 func (r *Repository) GetUnpublishedOutbox(ctx context.Context, limit int) ([]OutboxRecord, error) {
 	rows, err := r.pool.Query(ctx, `
-		SELECT id, aggregate_type, aggregate_id, event_type, payload_json, created_at, published_at, status, dedupe_key
+		SELECT `+outboxColumns+`
 		FROM outbox WHERE status = 'NEW' ORDER BY created_at ASC LIMIT $1 FOR UPDATE SKIP LOCKED
 	`, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanOutbox(rows)
+}
+
+// GetOutboxSince returns the records of the given aggregate types that come
+// after the record (since, afterID) in (created_at, id) order, oldest first,
+// whatever their publishing status. Pass uuid.Nil to start at since; paging
+// on the id as well keeps records that share a created_at from being skipped
+// at a page boundary.
+func (r *Repository) GetOutboxSince(ctx context.Context, since time.Time, afterID uuid.UUID, limit int, aggregateTypes ...string) ([]OutboxRecord, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+outboxColumns+`
+		FROM outbox WHERE aggregate_type = ANY($4::STRING[]) AND (created_at, id) > ($1, $2)
+		ORDER BY created_at, id LIMIT $3
+	`, since, afterID, limit, aggregateTypes)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
 
+// GetSeatOutboxAfter returns the hold and order records of eventID that were
+// created after the record afterID, oldest first. It fails with ErrNotFound
+// if afterID is not in the outbox.
+func (r *Repository) GetSeatOutboxAfter(ctx context.Context, eventID, afterID uuid.UUID, limit int) ([]OutboxRecord, error) {
+	var createdAt time.Time
+	err := r.pool.QueryRow(ctx, `SELECT created_at FROM outbox WHERE id = $1`, afterID).Scan(&createdAt)
+	if err == pgx.ErrNoRows {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+outboxColumns+`
+		FROM outbox
+		WHERE aggregate_type IN ('hold', 'order') AND payload_json->>'event_id' = $1
+			AND (created_at, id) > ($2, $3)
+		ORDER BY created_at, id LIMIT $4
+	`, eventID.String(), createdAt, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+func scanOutbox(rows pgx.Rows) ([]OutboxRecord, error) {
+	defer rows.Close()
 	var records []OutboxRecord
 	for rows.Next() {
 		var rec OutboxRecord
@@ -47,7 +128,7 @@ func (r *Repository) GetUnpublishedOutbox(ctx context.Context, limit int) ([]Out
 		}
 		records = append(records, rec)
 	}
-	return records, nil
+	return records, rows.Err()
 }
 
 func (r *Repository) MarkPublished(ctx context.Context, id uuid.UUID, publishedAt time.Time, dedupeKey string) error {
@@ -56,3 +137,16 @@ func (r *Repository) MarkPublished(ctx context.Context, id uuid.UUID, publishedA
 	`, id, publishedAt, dedupeKey)
 	return err
 }
+
+// InsertInbox records an inbound message id and reports false if it was
+// already seen, so the caller can acknowledge a redelivery without reapplying it.
+func (r *Repository) InsertInbox(ctx context.Context, tx pgx.Tx, messageID string) (bool, error) {
+	result, err := tx.Exec(ctx, `
+		INSERT INTO inbox (message_id, received_at) VALUES ($1, now())
+		ON CONFLICT (message_id) DO NOTHING
+	`, messageID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
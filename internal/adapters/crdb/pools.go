@@ -0,0 +1,224 @@
+package crdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+// poolTakenSQL sums the admissions of an event's pools per pool and state:
+// held by ACTIVE holds that have not lapsed at $2, held by orders awaiting
+// payment, or sold.
+const poolTakenSQL = `
+	SELECT pool_id, 'held', sum(quantity)::INT8 FROM pool_holds
+	WHERE event_id = $1 AND status = 'ACTIVE' AND expires_at > $2
+	GROUP BY pool_id
+	UNION ALL
+	SELECT i.pool_id, IF(o.status = 'CONFIRMED', 'sold', 'held'), sum(i.quantity)::INT8
+	FROM order_pool_items i JOIN orders o ON o.id = i.order_id
+	WHERE i.event_id = $1 AND o.status IN ('PENDING', 'AWAITING_PAYMENT', 'CONFIRMED')
+	GROUP BY 1, 2
+`
+
+// holdPools takes the pool admissions of hold. Pools that are not sellable
+// pools of the event fail the hold with a PoolsNotForSaleError, and pools
+// with fewer admissions left than requested with a PoolsUnavailableError.
+//
+// The pool rows are locked first, so holds on the same pool queue up rather
+// than both counting the same admissions as free. Serializable isolation
+// would refuse such an oversell anyway; the lock only saves the retries.
+func holdPools(ctx context.Context, tx pgx.Tx, hold domain.Hold) error {
+	ids := make([]string, len(hold.Pools))
+	quantities := make([]int, len(hold.Pools))
+	for i, p := range hold.Pools {
+		ids[i], quantities[i] = p.Pool, p.Quantity
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT pool_id, capacity, sellable FROM pools
+		WHERE event_id = $1 AND pool_id = ANY($2::STRING[])
+		ORDER BY pool_id
+		FOR UPDATE
+	`, hold.EventID, ids)
+	if err != nil {
+		return err
+	}
+	pools, err := scanPools(rows)
+	if err != nil {
+		return err
+	}
+	notForSale := &domain.PoolsNotForSaleError{}
+	for _, p := range hold.Pools {
+		if !pools[p.Pool].Sellable {
+			notForSale.Pools = append(notForSale.Pools, p.Pool)
+		}
+	}
+	if len(notForSale.Pools) > 0 {
+		return notForSale
+	}
+
+	rows, err = tx.Query(ctx, poolTakenSQL, hold.EventID, hold.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if err := addPoolsTaken(rows, pools); err != nil {
+		return err
+	}
+	short := &domain.PoolsUnavailableError{Remaining: map[string]int{}}
+	for _, p := range hold.Pools {
+		if left := pools[p.Pool].Remaining(); p.Quantity > left {
+			short.Pools = append(short.Pools, p.Pool)
+			short.Remaining[p.Pool] = left
+		}
+	}
+	if len(short.Pools) > 0 {
+		return short
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO pool_holds (hold_id, event_id, pool_id, quantity, user_id, created_at, expires_at, status)
+		SELECT $1, $2, t.pool_id, t.quantity, $3, $4, $5, 'ACTIVE'
+		FROM unnest($6::STRING[], $7::INT8[]) AS t (pool_id, quantity)
+	`, hold.ID, hold.EventID, hold.UserID, hold.CreatedAt, hold.ExpiresAt, ids, quantities)
+	return err
+}
+
+// GetPoolAvailability returns every pool CockroachDB has for an event with
+// its admissions held and sold at now.
+func (r *Repository) GetPoolAvailability(ctx context.Context, eventID uuid.UUID, now time.Time) (map[string]domain.PoolAvailability, error) {
+	rows, err := r.pool.Query(ctx, `SELECT pool_id, capacity, sellable FROM pools WHERE event_id = $1`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	pools, err := scanPools(rows)
+	if err != nil || len(pools) == 0 {
+		return pools, err
+	}
+	rows, err = r.pool.Query(ctx, poolTakenSQL, eventID, now)
+	if err != nil {
+		return nil, err
+	}
+	return pools, addPoolsTaken(rows, pools)
+}
+
+func scanPools(rows pgx.Rows) (map[string]domain.PoolAvailability, error) {
+	defer rows.Close()
+
+	pools := map[string]domain.PoolAvailability{}
+	for rows.Next() {
+		var id string
+		var pool domain.PoolAvailability
+		if err := rows.Scan(&id, &pool.Capacity, &pool.Sellable); err != nil {
+			return nil, err
+		}
+		pools[id] = pool
+	}
+	return pools, rows.Err()
+}
+
+// addPoolsTaken adds the rows of poolTakenSQL to the pools already in pools.
+func addPoolsTaken(rows pgx.Rows, pools map[string]domain.PoolAvailability) error {
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var state domain.SeatState
+		var quantity int
+		if err := rows.Scan(&id, &state, &quantity); err != nil {
+			return err
+		}
+		pool, ok := pools[id]
+		if !ok {
+			continue
+		}
+		if state == domain.SeatSold {
+			pool.Sold += quantity
+		} else {
+			pool.Held += quantity
+		}
+		pools[id] = pool
+	}
+	return rows.Err()
+}
+
+// savePools brings the pools of event in line with event.Pools, the way
+// SaveEvent does for seats. Capacity may be lowered below what is already
+// taken; that only stops further sales.
+func savePools(ctx context.Context, tx pgx.Tx, event domain.Event) error {
+	ids := make([]string, len(event.Pools))
+	capacities := make([]int, len(event.Pools))
+	sellable := make([]bool, len(event.Pools))
+	for i, pool := range event.Pools {
+		ids[i], capacities[i], sellable[i] = pool.PoolID, pool.Capacity, pool.Sellable
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT pool_id FROM pool_holds
+		WHERE event_id = $1 AND status = 'ACTIVE' AND expires_at > now() AND pool_id <> ALL($2::STRING[])
+		UNION
+		SELECT i.pool_id FROM order_pool_items i JOIN orders o ON o.id = i.order_id
+		WHERE i.event_id = $1 AND o.status IN ('PENDING', 'AWAITING_PAYMENT', 'CONFIRMED')
+			AND i.pool_id <> ALL($2::STRING[])
+		ORDER BY pool_id
+	`, event.ID, ids)
+	if err != nil {
+		return err
+	}
+	taken, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	if len(taken) > 0 {
+		return &domain.PoolsUnavailableError{Pools: taken}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM pools p WHERE p.event_id = $1 AND p.pool_id <> ALL($2::STRING[])
+			AND NOT EXISTS (SELECT 1 FROM pool_holds h WHERE h.event_id = p.event_id AND h.pool_id = p.pool_id)
+			AND NOT EXISTS (SELECT 1 FROM order_pool_items i WHERE i.event_id = p.event_id AND i.pool_id = p.pool_id)
+	`, event.ID, ids); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE pools SET sellable = false WHERE event_id = $1 AND pool_id <> ALL($2::STRING[]) AND sellable
+	`, event.ID, ids); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO pools (event_id, pool_id, capacity, sellable)
+		SELECT $1, t.pool_id, t.capacity, t.sellable
+		FROM unnest($2::STRING[], $3::INT8[], $4::BOOL[]) AS t (pool_id, capacity, sellable)
+		ON CONFLICT (event_id, pool_id) DO UPDATE SET capacity = excluded.capacity, sellable = excluded.sellable
+	`, event.ID, ids, capacities, sellable)
+	return err
+}
+
+// insertOrderPoolItems writes the pool items of an order in one statement.
+func insertOrderPoolItems(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, items []domain.OrderItem) error {
+	n := len(items)
+	eventIDs := make([]uuid.UUID, n)
+	pools := make([]string, n)
+	quantities := make([]int, n)
+	prices := make([]string, n)
+	currencies := make([]string, n)
+	breakdowns := make([]string, n)
+	for i, item := range items {
+		breakdown, err := marshalBreakdown(item.Breakdown)
+		if err != nil {
+			return err
+		}
+		eventIDs[i], pools[i], quantities[i] = item.EventID, item.Pool, item.Quantity
+		prices[i], currencies[i], breakdowns[i] = item.Price.Decimal(), item.Price.Currency, string(breakdown)
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO order_pool_items (order_id, event_id, pool_id, quantity, price, currency, breakdown)
+		SELECT $1, t.event_id, t.pool_id, t.quantity, t.price::DECIMAL, t.currency, t.breakdown::JSONB
+		FROM unnest($2::UUID[], $3::STRING[], $4::INT8[], $5::STRING[], $6::STRING[], $7::STRING[])
+			AS t (event_id, pool_id, quantity, price, currency, breakdown)
+	`, orderID, eventIDs, pools, quantities, prices, currencies, breakdowns)
+	return err
+}
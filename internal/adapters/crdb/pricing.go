@@ -0,0 +1,39 @@
+package crdb
+
+import (
+	"encoding/json"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+// priceComponentRow is the JSONB shape of order_items.breakdown; amounts stay
+// in minor units so the stored breakdown is exact.
+type priceComponentRow struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func marshalBreakdown(components []domain.PriceComponent) ([]byte, error) {
+	rows := make([]priceComponentRow, len(components))
+	for i, c := range components {
+		rows[i] = priceComponentRow{Kind: c.Kind, Name: c.Name, Amount: c.Amount.Amount, Currency: c.Amount.Currency}
+	}
+	return json.Marshal(rows)
+}
+
+func unmarshalBreakdown(data []byte) ([]domain.PriceComponent, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var rows []priceComponentRow
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	components := make([]domain.PriceComponent, len(rows))
+	for i, r := range rows {
+		components[i] = domain.PriceComponent{Kind: r.Kind, Name: r.Name, Amount: domain.NewMoney(r.Amount, r.Currency)}
+	}
+	return components, nil
+}
@@ -2,6 +2,10 @@ package crdb
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -10,22 +14,82 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
-	"golang.org/x/sync/errgroup"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
 )
 
 const (
 	SerializationFailureCode = "40001"
 )
 
+// RetryPolicy bounds how WithTx retries serialization failures. Zero
+// fields take the defaults below.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Timeout bounds a whole WithTx, retries included: a transaction that is
+	// not ready to commit by then is rolled back instead. It defaults to
+	// every attempt waiting out MaxDelay plus txBodyAllowance for the bodies.
+	Timeout time.Duration
+}
+
+// txBodyAllowance is the time the default Timeout leaves for running the
+// transaction bodies themselves.
+const txBodyAllowance = 10 * time.Second
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 5
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 20 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = time.Second
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = time.Duration(p.MaxAttempts)*p.MaxDelay + txBodyAllowance
+	}
+	return p
+}
+
+// backoff returns a full-jitter delay before the given retry, so clients
+// that collided do not collide again in lockstep.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := retry - 1; shift < 30 && p.BaseDelay<<shift < ceiling {
+		ceiling = p.BaseDelay << shift
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
 type Repository struct {
-	pool *pgxpool.Pool
+	pool  *pgxpool.Pool
+	retry RetryPolicy
 }
 
-func NewRepository(pool *pgxpool.Pool) *Repository {
-	return &Repository{pool: pool}
+func NewRepository(pool *pgxpool.Pool, retry RetryPolicy) *Repository {
+	return &Repository{pool: pool, retry: retry.withDefaults()}
 }
 
+// TxTimeout is the longest a WithTx transaction can take from its start to
+// its commit.
+func (r *Repository) TxTimeout() time.Duration {
+	return r.retry.Timeout
+}
+
+// WithTx runs fn in a SERIALIZABLE transaction using CockroachDB's
+// client-side retry protocol: on a serialization failure the transaction
+// rolls back to the cockroach_restart savepoint and fn runs again, so fn
+// must not have side effects outside tx that are unsafe to repeat. Only
+// when the attempt budget or the timeout is spent does the caller get
+// ErrSerializationFailure.
 func (r *Repository) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	start := time.Now()
+	defer func() { observability.DBTxDuration.Observe(time.Since(start).Seconds()) }()
+	deadline := start.Add(r.retry.Timeout)
+
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return err
@@ -36,32 +100,181 @@ func (r *Repository) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error
 	if err != nil {
 		return err
 	}
-
-	err = fn(tx)
+	_, err = tx.Exec(ctx, "SAVEPOINT cockroach_restart")
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == SerializationFailureCode {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = r.attempt(ctx, tx, deadline, fn)
+		if err == nil {
+			break
+		}
+		if !isSerializationFailure(err) {
+			return err
+		}
+		if attempt >= r.retry.MaxAttempts {
 			return domain.ErrSerializationFailure
 		}
+
+		observability.DBTxRetries.Inc()
+		if _, err := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT cockroach_restart"); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.retry.backoff(attempt)):
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if isSerializationFailure(err) {
+		return domain.ErrSerializationFailure
+	}
+	return err
+}
+
+// attempt runs one try of a WithTx body. Releasing the cockroach_restart
+// savepoint is what commits in CockroachDB, so it can also report a
+// retryable error. Nothing commits after deadline, which is what lets
+// outbox readers bound how late a record can show up.
+func (r *Repository) attempt(ctx context.Context, tx pgx.Tx, deadline time.Time, fn func(tx pgx.Tx) error) error {
+	if err := fn(tx); err != nil {
 		return err
 	}
+	if claim, ok := idempotency.ClaimFrom(ctx); ok {
+		if err := claimIdempotencyKey(ctx, tx, claim); err != nil {
+			return err
+		}
+	}
+	if time.Now().After(deadline) {
+		return fmt.Errorf("%w: transaction ran past its %s timeout", domain.ErrSerializationFailure, r.retry.Timeout)
+	}
+	commitCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	_, err := tx.Exec(commitCtx, "RELEASE SAVEPOINT cockroach_restart")
+	return err
+}
 
-	return tx.Commit(ctx)
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == SerializationFailureCode
 }
 
+// CreateHold stores the seats and pool admissions of hold; if any of them
+// cannot be taken, nothing is.
 func (r *Repository) CreateHold(ctx context.Context, tx pgx.Tx, hold domain.Hold) error {
+	if len(hold.Seats) > 0 {
+		if err := r.holdSeats(ctx, tx, hold); err != nil {
+			return err
+		}
+	}
+	if len(hold.Pools) > 0 {
+		return holdPools(ctx, tx, hold)
+	}
+	return nil
+}
+
+// holdSeats inserts all seats of hold in one statement. Seats that are not
+// sellable seats of the event fail the hold with a SeatsNotForSaleError. A
+// seat whose ACTIVE hold has already lapsed but not yet been swept by the
+// expiry worker is taken over once that hold is expired; any other taken
+// seat, including one in an order that is pending, awaiting payment or
+// confirmed, fails the whole hold with a SeatsUnavailableError listing them.
+func (r *Repository) holdSeats(ctx context.Context, tx pgx.Tx, hold domain.Hold) error {
+	rows, err := tx.Query(ctx, `
+		SELECT t.seat_no FROM unnest($2::STRING[]) AS t (seat_no)
+		WHERE NOT EXISTS (SELECT 1 FROM seats s WHERE s.event_id = $1 AND s.seat_no = t.seat_no AND s.sellable)
+	`, hold.EventID, hold.Seats)
+	if err != nil {
+		return err
+	}
+	notForSale, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	if len(notForSale) > 0 {
+		return &domain.SeatsNotForSaleError{Seats: notForSale}
+	}
+	if err := r.expireLapsedHolds(ctx, tx, hold); err != nil {
+		return err
+	}
+
+	rows, err = tx.Query(ctx, `
+		INSERT INTO holds (id, event_id, seat_no, user_id, created_at, expires_at, status)
+		SELECT $1, $2, t.seat_no, $3, $4, $5, 'ACTIVE' FROM unnest($6::STRING[]) AS t (seat_no)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM order_items i JOIN orders o ON o.id = i.order_id
+			WHERE i.event_id = $2 AND i.seat_no = t.seat_no
+				AND o.status IN ('PENDING', 'AWAITING_PAYMENT', 'CONFIRMED')
+		)
+		ON CONFLICT (event_id, seat_no) WHERE status = 'ACTIVE' DO NOTHING
+		RETURNING seat_no
+	`, hold.ID, hold.EventID, hold.UserID, hold.CreatedAt, hold.ExpiresAt, hold.Seats)
+	if err != nil {
+		return err
+	}
+	inserted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	if len(inserted) == len(hold.Seats) {
+		return nil
+	}
+
+	got := make(map[string]bool, len(inserted))
+	for _, seat := range inserted {
+		got[seat] = true
+	}
+	conflict := &domain.SeatsUnavailableError{HeldUntil: map[string]time.Time{}}
 	for _, seat := range hold.Seats {
-		result, err := tx.Exec(ctx, `
-			INSERT INTO holds (id, event_id, seat_no, user_id, expires_at, status)
-			VALUES ($1, $2, $3, $4, $5, 'ACTIVE')
-			ON CONFLICT (event_id, seat_no) WHERE status = 'ACTIVE' DO NOTHING
-			RETURNING id
-		`, hold.ID, hold.EventID, seat, hold.UserID, hold.ExpiresAt)
-		if err != nil {
+		if !got[seat] {
+			conflict.Seats = append(conflict.Seats, seat)
+		}
+	}
+
+	// Seats taken by an order have no ACTIVE hold and so no held_until.
+	rows, err = tx.Query(ctx, `
+		SELECT seat_no, expires_at FROM holds
+		WHERE event_id = $1 AND seat_no = ANY($2::STRING[]) AND status = 'ACTIVE'
+	`, hold.EventID, conflict.Seats)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seat string
+		var expiresAt time.Time
+		if err := rows.Scan(&seat, &expiresAt); err != nil {
 			return err
 		}
-		if result.RowsAffected() == 0 {
-			return domain.ErrConflict
+		conflict.HeldUntil[seat] = expiresAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return conflict
+}
+
+// expireLapsedHolds expires the ACTIVE holds on seats of hold that lapsed by
+// the time hold was made, writing hold.expired for each as the expiry worker
+// would, so that their seats can be taken.
+func (r *Repository) expireLapsedHolds(ctx context.Context, tx pgx.Tx, hold domain.Hold) error {
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT id FROM holds
+		WHERE event_id = $1 AND seat_no = ANY($2::STRING[]) AND status = 'ACTIVE' AND expires_at <= $3
+	`, hold.EventID, hold.Seats, hold.CreatedAt)
+	if err != nil {
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := r.ExpireHold(ctx, tx, id); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -69,58 +282,290 @@ func (r *Repository) CreateHold(ctx context.Context, tx pgx.Tx, hold domain.Hold
 
 func (r *Repository) CreateOrder(ctx context.Context, tx pgx.Tx, order domain.Order) error {
 	_, err := tx.Exec(ctx, `
-		INSERT INTO orders (id, user_id, status, total_amount)
-		VALUES ($1, $2, 'PENDING', $3)
-	`, order.ID, order.UserID, order.TotalAmount)
+		INSERT INTO orders (id, user_id, hold_id, status, total_amount, currency)
+		VALUES ($1, $2, $3, $4, $5::DECIMAL, $6)
+	`, order.ID, order.UserID, order.HoldID, order.Status, order.TotalAmount.Decimal(), order.TotalAmount.Currency)
 	if err != nil {
 		return err
 	}
 
-	g, gctx := errgroup.WithContext(ctx)
-	for _, item := range order.Items {
-		item := item
-		g.Go(func() error {
-			_, err := tx.Exec(gctx, `
-				INSERT INTO order_items (order_id, event_id, seat_no, price)
-				VALUES ($1, $2, $3, $4)
-			`, order.ID, item.EventID, item.SeatNo, item.Price)
-			return err
-		})
+	if err := insertOrderItems(ctx, tx, order); err != nil {
+		return err
 	}
-	if err := g.Wait(); err != nil {
+
+	released, err := releaseHoldRows(ctx, tx, order.HoldID)
+	if err != nil {
 		return err
 	}
+	if released != int64(len(order.Items)) {
+		return domain.ErrConflict
+	}
+
+	return nil
+}
 
+// insertOrderItems writes all seat items in one statement and all pool
+// items in another. A pgx.Tx is bound to a single connection, so its
+// statements must not be issued concurrently.
+func insertOrderItems(ctx context.Context, tx pgx.Tx, order domain.Order) error {
+	var eventIDs []uuid.UUID
+	var seatNos, prices, currencies, breakdowns []string
+	var pools []domain.OrderItem
 	for _, item := range order.Items {
-		_, err := tx.Exec(ctx, `
-			UPDATE holds SET status = 'RELEASED'
-			WHERE event_id = $1 AND seat_no = $2 AND status = 'ACTIVE'
-		`, item.EventID, item.SeatNo)
+		if item.Pool != "" {
+			pools = append(pools, item)
+			continue
+		}
+		breakdown, err := marshalBreakdown(item.Breakdown)
 		if err != nil {
 			return err
 		}
+		eventIDs = append(eventIDs, item.EventID)
+		seatNos = append(seatNos, item.SeatNo)
+		prices = append(prices, item.Price.Decimal())
+		currencies = append(currencies, item.Price.Currency)
+		breakdowns = append(breakdowns, string(breakdown))
+	}
+	if len(pools) > 0 {
+		if err := insertOrderPoolItems(ctx, tx, order.ID, pools); err != nil {
+			return err
+		}
+	}
+	if len(seatNos) == 0 {
+		return nil
 	}
 
-	return nil
+	_, err := tx.Exec(ctx, `
+		INSERT INTO order_items (order_id, event_id, seat_no, price, currency, breakdown)
+		SELECT $1, t.event_id, t.seat_no, t.price::DECIMAL, t.currency, t.breakdown::JSONB
+		FROM unnest($2::UUID[], $3::STRING[], $4::STRING[], $5::STRING[], $6::STRING[])
+			AS t (event_id, seat_no, price, currency, breakdown)
+	`, order.ID, eventIDs, seatNos, prices, currencies, breakdowns)
+	return err
 }
 
-func (r *Repository) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status string) error {
-	result, err := r.pool.Exec(ctx, `
-		UPDATE orders SET status = $2 WHERE id = $1
-	`, orderID, status)
+func (r *Repository) GetHold(ctx context.Context, holdID uuid.UUID) (*domain.Hold, error) {
+	hold := &domain.Hold{ID: holdID}
+	rows, err := r.pool.Query(ctx, `
+		SELECT event_id, seat_no, user_id, status, created_at, expires_at
+		FROM holds WHERE id = $1
+		ORDER BY seat_no
+	`, holdID)
+	if err != nil {
+		return nil, err
+	}
+	if err := scanHoldSeats(rows, hold); err != nil {
+		return nil, err
+	}
+	rows, err = r.pool.Query(ctx, `
+		SELECT event_id, pool_id, quantity, user_id, status, created_at, expires_at
+		FROM pool_holds WHERE hold_id = $1
+		ORDER BY pool_id
+	`, holdID)
+	if err != nil {
+		return nil, err
+	}
+	return scanHoldPools(rows, hold)
+}
+
+func (r *Repository) GetActiveHold(ctx context.Context, tx pgx.Tx, holdID uuid.UUID) (*domain.Hold, error) {
+	hold := &domain.Hold{ID: holdID}
+	rows, err := tx.Query(ctx, `
+		SELECT event_id, seat_no, user_id, status, created_at, expires_at
+		FROM holds WHERE id = $1 AND status = 'ACTIVE'
+		ORDER BY seat_no
+		FOR UPDATE
+	`, holdID)
+	if err != nil {
+		return nil, err
+	}
+	if err := scanHoldSeats(rows, hold); err != nil {
+		return nil, err
+	}
+	rows, err = tx.Query(ctx, `
+		SELECT event_id, pool_id, quantity, user_id, status, created_at, expires_at
+		FROM pool_holds WHERE hold_id = $1 AND status = 'ACTIVE'
+		ORDER BY pool_id
+		FOR UPDATE
+	`, holdID)
+	if err != nil {
+		return nil, err
+	}
+	return scanHoldPools(rows, hold)
+}
+
+func scanHoldSeats(rows pgx.Rows, hold *domain.Hold) error {
+	defer rows.Close()
+
+	for rows.Next() {
+		var seatNo string
+		if err := rows.Scan(&hold.EventID, &seatNo, &hold.UserID, &hold.Status, &hold.CreatedAt, &hold.ExpiresAt); err != nil {
+			return err
+		}
+		hold.Seats = append(hold.Seats, seatNo)
+	}
+	return rows.Err()
+}
+
+// scanHoldPools adds the pool rows of a hold to the seats already read,
+// failing with ErrNotFound if the hold has neither.
+func scanHoldPools(rows pgx.Rows, hold *domain.Hold) (*domain.Hold, error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		var pool domain.PoolQuantity
+		if err := rows.Scan(&hold.EventID, &pool.Pool, &pool.Quantity, &hold.UserID, &hold.Status, &hold.CreatedAt, &hold.ExpiresAt); err != nil {
+			return nil, err
+		}
+		hold.Pools = append(hold.Pools, pool)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(hold.Seats) == 0 && len(hold.Pools) == 0 {
+		return nil, domain.ErrNotFound
+	}
+	return hold, nil
+}
+
+func (r *Repository) ExtendHold(ctx context.Context, tx pgx.Tx, holdID uuid.UUID, expiresAt time.Time) error {
+	result, err := tx.Exec(ctx, `
+		UPDATE holds SET expires_at = $2 WHERE id = $1 AND status = 'ACTIVE'
+	`, holdID, expiresAt)
 	if err != nil {
 		return err
 	}
-	if result.RowsAffected() == 0 {
+	extended := result.RowsAffected()
+	result, err = tx.Exec(ctx, `
+		UPDATE pool_holds SET expires_at = $2 WHERE hold_id = $1 AND status = 'ACTIVE'
+	`, holdID, expiresAt)
+	if err != nil {
+		return err
+	}
+	if extended+result.RowsAffected() == 0 {
 		return domain.ErrNotFound
 	}
 	return nil
 }
 
+// TransitionOrder moves an order to status `to` if the state machine allows it,
+// recording a history row and an outbox event in the same transaction. It
+// returns the status the order moved from.
+func (r *Repository) TransitionOrder(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, to domain.OrderStatus, reason string) (domain.OrderStatus, error) {
+	var current string
+	err := tx.QueryRow(ctx, `
+		SELECT status FROM orders WHERE id = $1 FOR UPDATE
+	`, orderID).Scan(&current)
+	if err == pgx.ErrNoRows {
+		return "", domain.ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	from := domain.OrderStatus(current)
+	if err := domain.ValidateOrderTransition(from, to); err != nil {
+		return from, err
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE orders SET status = $3, updated_at = now() WHERE id = $1 AND status = $2
+	`, orderID, from, to)
+	if err != nil {
+		return from, err
+	}
+	if result.RowsAffected() == 0 {
+		return from, domain.ErrConflict
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO order_status_history (id, order_id, from_status, to_status, reason)
+		VALUES ($1, $2, $3, $4, $5)
+	`, uuid.New(), orderID, from, to, reason)
+	if err != nil {
+		return from, err
+	}
+
+	eventID, seats, pools, err := orderContents(ctx, tx, orderID)
+	if err != nil {
+		return from, err
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"order_id":    orderID,
+		"event_id":    eventID,
+		"seats":       seats,
+		"pools":       poolsPayload(pools),
+		"from_status": from,
+		"status":      to,
+		"reason":      reason,
+	})
+	if err != nil {
+		return from, err
+	}
+	return from, r.InsertOutbox(ctx, tx, OutboxRecord{
+		ID:            uuid.New(),
+		AggregateType: "order",
+		AggregateID:   orderID,
+		EventType:     "order." + strings.ToLower(string(to)),
+		Payload:       payload,
+		DedupeKey:     uuid.New().String(),
+	})
+}
+
+// GetLapsedOrders returns the ids of orders that have been awaiting payment
+// since before, oldest first.
+func (r *Repository) GetLapsedOrders(ctx context.Context, before time.Time, limit int) ([]uuid.UUID, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id FROM orders
+		WHERE status = 'AWAITING_PAYMENT' AND updated_at <= $1
+		ORDER BY updated_at LIMIT $2
+	`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+// orderContents returns the event, seats and pool admissions an order was
+// placed for; an order always comes from a single hold, so it covers one
+// event.
+func orderContents(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) (uuid.UUID, []string, []domain.PoolQuantity, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT event_id, seat_no, '', 1 FROM order_items WHERE order_id = $1
+		UNION ALL
+		SELECT event_id, '', pool_id, quantity FROM order_pool_items WHERE order_id = $1
+		ORDER BY 3, 2
+	`, orderID)
+	if err != nil {
+		return uuid.Nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	var eventID uuid.UUID
+	seats := []string{}
+	var pools []domain.PoolQuantity
+	for rows.Next() {
+		var seatNo string
+		var pool domain.PoolQuantity
+		if err := rows.Scan(&eventID, &seatNo, &pool.Pool, &pool.Quantity); err != nil {
+			return uuid.Nil, nil, nil, err
+		}
+		if pool.Pool != "" {
+			pools = append(pools, pool)
+		} else {
+			seats = append(seats, seatNo)
+		}
+	}
+	return eventID, seats, pools, rows.Err()
+}
+
 func (r *Repository) GetExpiredHolds(ctx context.Context, now time.Time) ([]domain.Hold, error) {
 	rows, err := r.pool.Query(ctx, `
-		SELECT id, event_id, seat_no, user_id, expires_at
+		SELECT id, event_id, seat_no, '', 0, user_id, expires_at
 		FROM holds WHERE status = 'ACTIVE' AND expires_at <= $1
+		UNION ALL
+		SELECT hold_id, event_id, '', pool_id, quantity, user_id, expires_at
+		FROM pool_holds WHERE status = 'ACTIVE' AND expires_at <= $1
+		ORDER BY 1, 3, 4
 	`, now)
 	if err != nil {
 		return nil, err
@@ -134,8 +579,9 @@ func (r *Repository) GetExpiredHolds(ctx context.Context, now time.Time) ([]doma
 	for rows.Next() {
 		var id, eventID, userID uuid.UUID
 		var seatNo string
+		var pool domain.PoolQuantity
 		var expiresAt time.Time
-		if err := rows.Scan(&id, &eventID, &seatNo, &userID, &expiresAt); err != nil {
+		if err := rows.Scan(&id, &eventID, &seatNo, &pool.Pool, &pool.Quantity, &userID, &expiresAt); err != nil {
 			return nil, err
 		}
 		if id != currentHoldID {
@@ -151,7 +597,14 @@ func (r *Repository) GetExpiredHolds(ctx context.Context, now time.Time) ([]doma
 			}
 			currentHoldID = id
 		}
-		currentHold.Seats = append(currentHold.Seats, seatNo)
+		if pool.Pool != "" {
+			currentHold.Pools = append(currentHold.Pools, pool)
+		} else {
+			currentHold.Seats = append(currentHold.Seats, seatNo)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 	if currentHold != nil {
 		holds = append(holds, *currentHold)
@@ -159,35 +612,118 @@ func (r *Repository) GetExpiredHolds(ctx context.Context, now time.Time) ([]doma
 	return holds, nil
 }
 
-func (r *Repository) ReleaseHold(ctx context.Context, holdID uuid.UUID) error {
-	result, err := r.pool.Exec(ctx, `
-		UPDATE holds SET status = 'RELEASED' WHERE id = $1 AND status = 'ACTIVE'
-	`, holdID)
+// GetSeatOccupancy returns the seats of an event that are not available,
+// keyed by seat number: seats under an unexpired ACTIVE hold or a pending
+// order are held, seats of a confirmed order are sold.
+func (r *Repository) GetSeatOccupancy(ctx context.Context, eventID uuid.UUID, now time.Time) (map[string]domain.SeatOccupancy, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT seat_no, 'held', expires_at
+		FROM holds WHERE event_id = $1 AND status = 'ACTIVE' AND expires_at > $2
+		UNION ALL
+		SELECT i.seat_no, IF(o.status = 'CONFIRMED', 'sold', 'held'), NULL
+		FROM order_items i JOIN orders o ON o.id = i.order_id
+		WHERE i.event_id = $1 AND o.status IN ('PENDING', 'AWAITING_PAYMENT', 'CONFIRMED')
+	`, eventID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occupied := map[string]domain.SeatOccupancy{}
+	for rows.Next() {
+		var seatNo string
+		var state domain.SeatState
+		var heldUntil *time.Time
+		if err := rows.Scan(&seatNo, &state, &heldUntil); err != nil {
+			return nil, err
+		}
+		seat := occupied[seatNo]
+		if seat.State != domain.SeatSold {
+			seat.State = state
+		}
+		if heldUntil != nil && heldUntil.After(seat.HeldUntil) {
+			seat.HeldUntil = *heldUntil
+		}
+		occupied[seatNo] = seat
+	}
+	return occupied, rows.Err()
+}
+
+func (r *Repository) ReleaseHold(ctx context.Context, tx pgx.Tx, holdID uuid.UUID) error {
+	released, err := releaseHoldRows(ctx, tx, holdID)
 	if err != nil {
 		return err
 	}
-	if result.RowsAffected() == 0 {
+	if released == 0 {
 		return domain.ErrNotFound
 	}
 	return nil
 }
 
+// ExpireHold marks the active rows of a lapsed hold EXPIRED and writes
+// hold.expired to the outbox. It fails with ErrNotFound if the hold is no
+// longer active.
+func (r *Repository) ExpireHold(ctx context.Context, tx pgx.Tx, holdID uuid.UUID) error {
+	hold, err := r.GetActiveHold(ctx, tx, holdID)
+	if err != nil {
+		return err
+	}
+	if _, err := endHoldRows(ctx, tx, holdID, "EXPIRED"); err != nil {
+		return err
+	}
+	hold.Status = "EXPIRED"
+	return r.InsertOutbox(ctx, tx, HoldOutboxRecord(*hold, "hold.expired"))
+}
+
+// releaseHoldRows releases the active seat and pool rows of a hold and
+// returns how many there were.
+func releaseHoldRows(ctx context.Context, tx pgx.Tx, holdID uuid.UUID) (int64, error) {
+	return endHoldRows(ctx, tx, holdID, "RELEASED")
+}
+
+// endHoldRows moves the active seat and pool rows of a hold to status and
+// returns how many there were.
+func endHoldRows(ctx context.Context, tx pgx.Tx, holdID uuid.UUID, status string) (int64, error) {
+	result, err := tx.Exec(ctx, `
+		UPDATE holds SET status = $2 WHERE id = $1 AND status = 'ACTIVE'
+	`, holdID, status)
+	if err != nil {
+		return 0, err
+	}
+	ended := result.RowsAffected()
+	result, err = tx.Exec(ctx, `
+		UPDATE pool_holds SET status = $2 WHERE hold_id = $1 AND status = 'ACTIVE'
+	`, holdID, status)
+	if err != nil {
+		return 0, err
+	}
+	return ended + result.RowsAffected(), nil
+}
+
 func (r *Repository) GetOrder(ctx context.Context, orderID uuid.UUID) (*domain.Order, error) {
 	var order domain.Order
+	var total, currency string
 	err := r.pool.QueryRow(ctx, `
-		SELECT id, user_id, status, total_amount
+		SELECT id, user_id, hold_id, status, total_amount::STRING, currency
 		FROM orders WHERE id = $1
-	`, orderID).Scan(&order.ID, &order.UserID, &order.Status, &order.TotalAmount)
+	`, orderID).Scan(&order.ID, &order.UserID, &order.HoldID, &order.Status, &total, &currency)
 	if err == pgx.ErrNoRows {
 		return nil, domain.ErrNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
+	if order.TotalAmount, err = domain.ParseMoney(total, currency); err != nil {
+		return nil, err
+	}
 
 	rows, err := r.pool.Query(ctx, `
-		SELECT event_id, seat_no, price
+		SELECT event_id, seat_no, '', 1, price::STRING, currency, breakdown
 		FROM order_items WHERE order_id = $1
+		UNION ALL
+		SELECT event_id, '', pool_id, quantity, price::STRING, currency, breakdown
+		FROM order_pool_items WHERE order_id = $1
+		ORDER BY 3, 2
 	`, orderID)
 	if err != nil {
 		return nil, err
@@ -196,11 +732,22 @@ func (r *Repository) GetOrder(ctx context.Context, orderID uuid.UUID) (*domain.O
 
 	for rows.Next() {
 		var item domain.OrderItem
-		if err := rows.Scan(&item.EventID, &item.SeatNo, &item.Price); err != nil {
+		var price, currency string
+		var breakdown []byte
+		if err := rows.Scan(&item.EventID, &item.SeatNo, &item.Pool, &item.Quantity, &price, &currency, &breakdown); err != nil {
+			return nil, err
+		}
+		if item.Price, err = domain.ParseMoney(price, currency); err != nil {
+			return nil, err
+		}
+		if item.Breakdown, err = unmarshalBreakdown(breakdown); err != nil {
 			return nil, err
 		}
 		order.Items = append(order.Items, item)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return &order, nil
 }
@@ -2,7 +2,13 @@ package crdb_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,61 +17,47 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 )
 
 func TestRepository_CreateHold(t *testing.T) {
 	ctx := context.Background()
+	pool := startOrderDB(t)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{})
 
-	crdbContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
-		ContainerRequest: testcontainers.ContainerRequest{
-			Image:        "cockroachdb/cockroach:v24.1.1",
-			Cmd:          []string{"start-single-node", "--insecure"},
-			ExposedPorts: []string{"26257/tcp"},
-			WaitingFor:   wait.ForHTTP("/health?ready=1").WithPort("8080"),
-		},
-		Started: true,
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer crdbContainer.Terminate(ctx)
-
-	dsn, err := crdbContainer.Endpoint(ctx, "postgresql")
+	eventID := uuid.New()
+	_, err := pool.Exec(ctx, `
+		INSERT INTO seats (event_id, seat_no, sellable)
+		VALUES ($1, 'A1', true), ($1, 'A2', true), ($1, 'A3', false)
+	`, eventID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	pool, err := pgxpool.New(ctx, dsn+"/tro?sslmode=disable")
-	if err != nil {
-		t.Fatal(err)
+	notForSale := domain.Hold{
+		ID:        uuid.New(),
+		EventID:   eventID,
+		Seats:     []string{"A1", "A3", "A9"},
+		UserID:    uuid.New(),
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(5 * time.Minute),
 	}
-	defer pool.Close()
-
-	_, err = pool.Exec(ctx, `
-		CREATE DATABASE IF NOT EXISTS tro;
-		CREATE TABLE IF NOT EXISTS tro.holds (
-			id UUID PRIMARY KEY,
-			event_id UUID,
-			seat_no TEXT,
-			user_id UUID,
-			expires_at TIMESTAMPTZ,
-			status TEXT CHECK (status IN ('ACTIVE', 'EXPIRED', 'RELEASED')),
-			UNIQUE (event_id, seat_no) WHERE status = 'ACTIVE'
-		);
-	`)
-	if err != nil {
-		t.Fatal(err)
+	err = repo.WithTx(ctx, func(tx pgx.Tx) error {
+		return repo.CreateHold(ctx, tx, notForSale)
+	})
+	var unsellable *domain.SeatsNotForSaleError
+	if !errors.As(err, &unsellable) || len(unsellable.Seats) != 2 || !errors.Is(err, domain.ErrInvalidInput) {
+		t.Fatalf("expected A3 and A9 to be reported not for sale, got %v", err)
 	}
 
-	repo := crdb.NewRepository(pool)
-
 	hold := domain.Hold{
 		ID:        uuid.New(),
-		EventID:   uuid.New(),
+		EventID:   eventID,
 		Seats:     []string{"A1", "A2"},
 		UserID:    uuid.New(),
+		CreatedAt: time.Now(),
 		ExpiresAt: time.Now().Add(5 * time.Minute),
 	}
 
@@ -81,18 +73,126 @@ func TestRepository_CreateHold(t *testing.T) {
 		EventID:   hold.EventID,
 		Seats:     []string{"A1"},
 		UserID:    uuid.New(),
+		CreatedAt: time.Now(),
 		ExpiresAt: time.Now().Add(5 * time.Minute),
 	}
 	err = repo.WithTx(ctx, func(tx pgx.Tx) error {
 		return repo.CreateHold(ctx, tx, conflictHold)
 	})
-	if !errors.Is(err, domain.ErrConflict) {
-		t.Errorf("expected conflict error, got %v", err)
+	var unavailable *domain.SeatsUnavailableError
+	if !errors.As(err, &unavailable) || len(unavailable.Seats) != 1 || unavailable.Seats[0] != "A1" {
+		t.Errorf("expected A1 to be reported unavailable, got %v", err)
 	}
+
 }
 
 func TestRepository_CreateOrder(t *testing.T) {
 	ctx := context.Background()
+	pool := startOrderDB(t)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{})
+
+	eventID := uuid.New()
+	if _, err := pool.Exec(ctx, `INSERT INTO seats (event_id, seat_no) VALUES ($1, 'A1'), ($1, 'A2')`, eventID); err != nil {
+		t.Fatal(err)
+	}
+	hold := domain.Hold{
+		ID:        uuid.New(),
+		EventID:   eventID,
+		Seats:     []string{"A1", "A2"},
+		UserID:    uuid.New(),
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(5 * time.Minute),
+	}
+	err := repo.WithTx(ctx, func(tx pgx.Tx) error {
+		return repo.CreateHold(ctx, tx, hold)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order domain.Order
+	err = repo.WithTx(ctx, func(tx pgx.Tx) error {
+		active, err := repo.GetActiveHold(ctx, tx, hold.ID)
+		if err != nil {
+			return err
+		}
+		if err := active.CanConvert(hold.UserID, time.Now()); err != nil {
+			return err
+		}
+		price := domain.NewMoney(10005, "EUR")
+		items := []domain.OrderItem{
+			{EventID: eventID, SeatNo: "A1", Quantity: 1, Price: price, Breakdown: []domain.PriceComponent{{Kind: "BASE", Name: "ticket", Amount: price}}},
+			{EventID: eventID, SeatNo: "A2", Quantity: 1, Price: price, Breakdown: []domain.PriceComponent{{Kind: "BASE", Name: "ticket", Amount: price}}},
+		}
+		order, err = domain.NewOrder(*active, items, "EUR", "card")
+		if err != nil {
+			return err
+		}
+		return repo.CreateOrder(ctx, tx, order)
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = repo.WithTx(ctx, func(tx pgx.Tx) error {
+		_, err := repo.GetActiveHold(ctx, tx, hold.ID)
+		return err
+	})
+	if !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("expected converted hold to be gone, got %v", err)
+	}
+
+	fetched, err := repo.GetOrder(ctx, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.Status != "PENDING" || len(fetched.Items) != 2 || fetched.HoldID != hold.ID {
+		t.Errorf("expected order with 2 items and PENDING, got %v with %d items", fetched.Status, len(fetched.Items))
+	}
+	if fetched.TotalAmount != domain.NewMoney(20010, "EUR") || fetched.Items[0].Price != domain.NewMoney(10005, "EUR") || len(fetched.Items[0].Breakdown) != 1 {
+		t.Errorf("expected total 200.10 EUR with a priced breakdown, got %v and %v", fetched.TotalAmount, fetched.Items[0])
+	}
+}
+
+func TestRepository_WithTxIdempotencyClaim(t *testing.T) {
+	ctx := context.Background()
+	pool := startOrderDB(t)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{})
+	store := crdb.NewIdempotencyStore(pool)
+
+	first := &idempotency.Claim{Key: "key-1", Fingerprint: "fp", TTL: time.Hour, Token: "t1"}
+	err := repo.WithTx(idempotency.WithClaim(ctx, first), func(tx pgx.Tx) error { return nil })
+	if err != nil {
+		t.Fatalf("expected claim to commit, got %v", err)
+	}
+
+	// A second request that lost its cache record must not commit again.
+	second := &idempotency.Claim{Key: "key-1", Fingerprint: "fp", TTL: time.Hour, Token: "t2"}
+	err = repo.WithTx(idempotency.WithClaim(ctx, second), func(tx pgx.Tx) error { return nil })
+	if !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("expected conflict for a committed key, got %v", err)
+	}
+
+	if err := store.Release(ctx, "key-1", "t1"); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := store.Get(ctx, "key-1")
+	if err != nil || rec == nil || rec.Status != 0 {
+		t.Fatalf("expected committed record to survive release, got %v %v", rec, err)
+	}
+
+	resp := idempotency.Record{Fingerprint: "fp", Status: 202, Header: map[string][]string{"Content-Type": {"application/json"}}, Result: []byte(`{}`)}
+	if err := store.Set(ctx, "key-1", resp, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	rec, err = store.Get(ctx, "key-1")
+	if err != nil || rec.Status != 202 || rec.Header["Content-Type"][0] != "application/json" || string(rec.Result) != `{}` {
+		t.Errorf("expected stored response, got %v %v", rec, err)
+	}
+}
+
+func TestRepository_WithTxRetriesSerializationFailures(t *testing.T) {
+	ctx := context.Background()
 
 	crdbContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
 		ContainerRequest: testcontainers.ContainerRequest{
@@ -113,81 +213,900 @@ func TestRepository_CreateOrder(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	pool, err := pgxpool.New(ctx, dsn+"/tro?sslmode=disable")
+	pool, err := pgxpool.New(ctx, dsn+"/defaultdb?sslmode=disable")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer pool.Close()
 
-	_, err = pool.Exec(ctx, `
-		CREATE DATABASE IF NOT EXISTS tro;
-		CREATE TABLE IF NOT EXISTS tro.orders (
-			id UUID PRIMARY KEY,
-			user_id UUID,
-			status TEXT CHECK (status IN ('PENDING', 'CONFIRMED', 'FAILED')),
-			total_amount NUMERIC
-		);
-		CREATE TABLE IF NOT EXISTS tro.order_items (
-			order_id UUID,
-			event_id UUID,
-			seat_no TEXT,
-			price NUMERIC,
-			PRIMARY KEY (order_id, event_id, seat_no)
-		);
-		CREATE TABLE IF NOT EXISTS tro.holds (
-			id UUID PRIMARY KEY,
-			event_id UUID,
-			seat_no TEXT,
-			user_id UUID,
-			expires_at TIMESTAMPTZ,
-			status TEXT CHECK (status IN ('ACTIVE', 'EXPIRED', 'RELEASED')),
-			UNIQUE (event_id, seat_no) WHERE status = 'ACTIVE'
-		);
-	`)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	repo := crdb.NewRepository(pool)
+	// force_retry fails with 40001 until the transaction is older than the
+	// given interval, so only a retried transaction can get through.
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{MaxAttempts: 50, BaseDelay: 10 * time.Millisecond, MaxDelay: 20 * time.Millisecond})
+	attempts := 0
+	err = repo.WithTx(ctx, func(tx pgx.Tx) error {
+		attempts++
+		_, err := tx.Exec(ctx, "SELECT crdb_internal.force_retry('100ms')")
+		return err
+	})
+	if err != nil || attempts < 2 {
+		t.Errorf("expected success after retries, got %v after %d attempts", err, attempts)
+	}
+
+	budget := crdb.NewRepository(pool, crdb.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	attempts = 0
+	err = budget.WithTx(ctx, func(tx pgx.Tx) error {
+		attempts++
+		_, err := tx.Exec(ctx, "SELECT crdb_internal.force_retry('1h')")
+		return err
+	})
+	if !errors.Is(err, domain.ErrSerializationFailure) || attempts != 2 {
+		t.Errorf("expected serialization failure after 2 attempts, got %v after %d", err, attempts)
+	}
 
-	eventID := uuid.New()
-	order := domain.Order{
-		ID:          uuid.New(),
-		UserID:      uuid.New(),
-		Status:      "PENDING",
-		TotalAmount: 200.0,
-		Items: []domain.OrderItem{
-			{EventID: eventID, SeatNo: "A1", Price: 100.0},
-			{EventID: eventID, SeatNo: "A2", Price: 100.0},
+	// A transaction that runs past its timeout is rolled back rather than
+	// committed late.
+	slow := crdb.NewRepository(pool, crdb.RetryPolicy{Timeout: 100 * time.Millisecond})
+	err = slow.WithTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT pg_sleep(0.2)")
+		return err
+	})
+	if !errors.Is(err, domain.ErrSerializationFailure) {
+		t.Errorf("expected a transaction past its timeout to fail, got %v", err)
+	}
+}
+
+// startOrderDB starts CockroachDB with the migrated schema and returns a pool
+// on it; the container is removed when tb finishes.
+func startOrderDB(tb testing.TB) *pgxpool.Pool {
+	ctx := context.Background()
+	crdbContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "cockroachdb/cockroach:v24.1.1",
+			Cmd:          []string{"start-single-node", "--insecure"},
+			ExposedPorts: []string{"26257/tcp"},
+			WaitingFor:   wait.ForHTTP("/health?ready=1").WithPort("8080"),
 		},
+		Started: true,
+	})
+	if err != nil {
+		tb.Fatal(err)
 	}
+	tb.Cleanup(func() { crdbContainer.Terminate(ctx) })
 
-	hold := domain.Hold{
+	dsn, err := crdbContainer.Endpoint(ctx, "postgresql")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	pool, err := pgxpool.New(ctx, dsn+"/tro?sslmode=disable")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(pool.Close)
+
+	migrate(tb, pool)
+	return pool
+}
+
+// migrate applies migrations/crdb in order, one statement at a time: a
+// schema change is not visible to later statements of the same batch.
+func migrate(tb testing.TB, pool *pgxpool.Pool) {
+	files, err := filepath.Glob("../../../migrations/crdb/*.sql")
+	if err != nil || len(files) == 0 {
+		tb.Fatalf("no migrations found: %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		var sql []string
+		for _, line := range strings.Split(string(data), "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+				sql = append(sql, line)
+			}
+		}
+		for _, stmt := range strings.Split(strings.Join(sql, "\n"), ";") {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := pool.Exec(context.Background(), stmt); err != nil {
+				tb.Fatalf("%s: %v", filepath.Base(file), err)
+			}
+		}
+	}
+}
+
+// heldOrder stores an active hold on seats and returns an order for it.
+func heldOrder(tb testing.TB, repo *crdb.Repository, seats int) domain.Order {
+	ctx := context.Background()
+	hold := domain.NewHold(uuid.New(), nil, uuid.New(), 5*time.Minute)
+	event := domain.Event{ID: hold.EventID, Title: "Concert", Status: domain.EventPublished}
+	for i := 0; i < seats; i++ {
+		hold.Seats = append(hold.Seats, fmt.Sprintf("S%03d", i))
+		event.Seats = append(event.Seats, domain.EventSeat{SeatNo: hold.Seats[i], Sellable: true})
+	}
+	err := repo.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := repo.SaveEvent(ctx, tx, event); err != nil {
+			return err
+		}
+		return repo.CreateHold(ctx, tx, hold)
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	price := domain.NewMoney(2500, "EUR")
+	items := make([]domain.OrderItem, len(hold.Seats))
+	for i, seat := range hold.Seats {
+		items[i] = domain.OrderItem{EventID: hold.EventID, SeatNo: seat, Quantity: 1, Price: price, Breakdown: []domain.PriceComponent{{Kind: "BASE", Name: "ticket", Amount: price}}}
+	}
+	order, err := domain.NewOrder(hold, items, "EUR", "card")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return order
+}
+
+// TestRepository_CreateOrderConcurrent is meant to be run with -race: many
+// orders are created at once, each with several items on its own tx.
+func TestRepository_CreateOrderConcurrent(t *testing.T) {
+	ctx := context.Background()
+	repo := crdb.NewRepository(startOrderDB(t), crdb.RetryPolicy{})
+
+	orders := make([]domain.Order, 16)
+	for i := range orders {
+		orders[i] = heldOrder(t, repo, 8)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(orders))
+	for _, order := range orders {
+		wg.Add(1)
+		go func(order domain.Order) {
+			defer wg.Done()
+			errs <- repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.CreateOrder(ctx, tx, order) })
+		}(order)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	}
+
+	for _, order := range orders {
+		fetched, err := repo.GetOrder(ctx, order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fetched.Items) != 8 || fetched.TotalAmount != domain.NewMoney(20000, "EUR") {
+			t.Errorf("expected 8 items totalling 200.00 EUR, got %d items and %v", len(fetched.Items), fetched.TotalAmount)
+		}
+	}
+}
+
+// BenchmarkCreateOrderItems compares the single unnest statement used by
+// CreateOrder with issuing one INSERT per item, which is what the old
+// goroutine-per-item code amounted to on a single connection.
+func BenchmarkCreateOrderItems(b *testing.B) {
+	ctx := context.Background()
+	pool := startOrderDB(b)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{})
+
+	for _, seats := range []int{4, 32} {
+		b.Run(fmt.Sprintf("unnest/%d", seats), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				order := heldOrder(b, repo, seats)
+				b.StartTimer()
+				err := repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.CreateOrder(ctx, tx, order) })
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("per_row/%d", seats), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				order := heldOrder(b, repo, seats)
+				b.StartTimer()
+				err := repo.WithTx(ctx, func(tx pgx.Tx) error {
+					for _, item := range order.Items {
+						_, err := tx.Exec(ctx, `
+							INSERT INTO order_items (order_id, event_id, seat_no, price, currency, breakdown)
+							VALUES ($1, $2, $3, $4::DECIMAL, $5, '[]')
+						`, order.ID, item.EventID, item.SeatNo, item.Price.Decimal(), item.Price.Currency)
+						if err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRepository_GetSeatOccupancy(t *testing.T) {
+	ctx := context.Background()
+	pool := startOrderDB(t)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{})
+
+	order := heldOrder(t, repo, 2)
+	eventID := order.Items[0].EventID
+	occupied, err := repo.GetSeatOccupancy(ctx, eventID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(occupied) != 2 || occupied["S000"].State != domain.SeatHeld || occupied["S000"].HeldUntil.IsZero() {
+		t.Fatalf("expected both seats held until the hold lapses, got %+v", occupied)
+	}
+	if occupied, _ := repo.GetSeatOccupancy(ctx, eventID, time.Now().Add(time.Hour)); len(occupied) != 0 {
+		t.Errorf("a lapsed hold must not occupy seats, got %+v", occupied)
+	}
+
+	if err := repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.CreateOrder(ctx, tx, order) }); err != nil {
+		t.Fatal(err)
+	}
+	occupied, err = repo.GetSeatOccupancy(ctx, eventID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if occupied["S001"].State != domain.SeatHeld || !occupied["S001"].HeldUntil.IsZero() {
+		t.Errorf("expected seats of a pending order held, got %+v", occupied)
+	}
+
+	if _, err := pool.Exec(ctx, `UPDATE orders SET status = 'CONFIRMED' WHERE id = $1`, order.ID); err != nil {
+		t.Fatal(err)
+	}
+	occupied, err = repo.GetSeatOccupancy(ctx, eventID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if occupied["S000"].State != domain.SeatSold || occupied["S001"].State != domain.SeatSold {
+		t.Errorf("expected seats of a confirmed order sold, got %+v", occupied)
+	}
+}
+
+// TestRepository_HoldOrderedSeat checks that a seat stays taken once its
+// hold has become an order, even though the hold rows are released.
+func TestRepository_TakeOverLapsedHold(t *testing.T) {
+	ctx := context.Background()
+	pool := startOrderDB(t)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{})
+
+	event := domain.Event{ID: uuid.New(), Title: "Concert", Status: domain.EventPublished, Seats: []domain.EventSeat{
+		{SeatNo: "B1", Sellable: true}, {SeatNo: "B2", Sellable: true},
+	}}
+	lapsed := domain.Hold{
 		ID:        uuid.New(),
-		EventID:   eventID,
-		Seats:     []string{"A1", "A2"},
-		UserID:    order.UserID,
-		ExpiresAt: time.Now().Add(5 * time.Minute),
+		EventID:   event.ID,
+		Seats:     []string{"B1", "B2"},
+		UserID:    uuid.New(),
+		CreatedAt: time.Now().Add(-10 * time.Minute),
+		ExpiresAt: time.Now().Add(-5 * time.Minute),
 	}
+	err := repo.WithTx(ctx, func(tx pgx.Tx) error {
+		if _, err := repo.SaveEvent(ctx, tx, event); err != nil {
+			return err
+		}
+		return repo.CreateHold(ctx, tx, lapsed)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	takeover := domain.NewHold(event.ID, []string{"B1"}, uuid.New(), 5*time.Minute)
+	if err := repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.CreateHold(ctx, tx, takeover) }); err != nil {
+		t.Fatalf("expected a lapsed hold to be taken over, got %v", err)
+	}
+
+	// The lapsed hold keeps all its seats and is expired as a whole.
+	old, err := repo.GetHold(ctx, lapsed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Status != "EXPIRED" || len(old.Seats) != 2 {
+		t.Errorf("expected the lapsed hold to be EXPIRED with both seats, got %s %v", old.Status, old.Seats)
+	}
+	current, err := repo.GetHold(ctx, takeover.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Status != "ACTIVE" || len(current.Seats) != 1 {
+		t.Errorf("expected the new hold to be ACTIVE on B1, got %s %v", current.Status, current.Seats)
+	}
+
+	var eventType string
+	var payload []byte
+	err = pool.QueryRow(ctx, `SELECT event_type, payload_json FROM outbox WHERE aggregate_id = $1`, lapsed.ID).Scan(&eventType, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record struct {
+		Status string   `json:"status"`
+		Seats  []string `json:"seats"`
+	}
+	if err := json.Unmarshal(payload, &record); err != nil {
+		t.Fatal(err)
+	}
+	if eventType != "hold.expired" || record.Status != "EXPIRED" || len(record.Seats) != 2 {
+		t.Errorf("expected hold.expired for both seats, got %s %+v", eventType, record)
+	}
+}
+
+func TestRepository_HoldOrderedSeat(t *testing.T) {
+	ctx := context.Background()
+	pool := startOrderDB(t)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{})
+
+	order := heldOrder(t, repo, 1)
+	if err := repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.CreateOrder(ctx, tx, order) }); err != nil {
+		t.Fatal(err)
+	}
+	rehold := func() error {
+		hold := domain.NewHold(order.Items[0].EventID, []string{"S000"}, uuid.New(), 5*time.Minute)
+		return repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.CreateHold(ctx, tx, hold) })
+	}
+
+	for _, status := range []domain.OrderStatus{domain.OrderPending, domain.OrderAwaitingPayment, domain.OrderConfirmed} {
+		if _, err := pool.Exec(ctx, `UPDATE orders SET status = $2 WHERE id = $1`, order.ID, status); err != nil {
+			t.Fatal(err)
+		}
+		err := rehold()
+		var unavailable *domain.SeatsUnavailableError
+		if !errors.As(err, &unavailable) || len(unavailable.Seats) != 1 || unavailable.Seats[0] != "S000" {
+			t.Fatalf("%s: expected S000 to be reported unavailable, got %v", status, err)
+		}
+		if _, ok := unavailable.HeldUntil["S000"]; ok {
+			t.Errorf("%s: an ordered seat has no hold to lapse, got %v", status, unavailable.HeldUntil)
+		}
+	}
+
+	if _, err := pool.Exec(ctx, `UPDATE orders SET status = 'FAILED' WHERE id = $1`, order.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := rehold(); err != nil {
+		t.Errorf("expected the seat of a failed order to be free again, got %v", err)
+	}
+}
+
+func TestRepository_SeatOutbox(t *testing.T) {
+	ctx := context.Background()
+	repo := crdb.NewRepository(startOrderDB(t), crdb.RetryPolicy{})
+
+	start := time.Now().Add(-time.Minute)
+	hold := domain.NewHold(uuid.New(), []string{"A1"}, uuid.New(), 5*time.Minute)
+	other := domain.NewHold(uuid.New(), []string{"B1"}, uuid.New(), 5*time.Minute)
+	var ids []uuid.UUID
+	for _, rec := range []crdb.OutboxRecord{
+		crdb.HoldOutboxRecord(hold, "hold.created"),
+		crdb.HoldOutboxRecord(other, "hold.created"),
+		crdb.HoldOutboxRecord(hold, "hold.extended"),
+		crdb.HoldOutboxRecord(hold, "hold.released"),
+	} {
+		// Separate transactions so created_at follows insertion order.
+		if err := repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.InsertOutbox(ctx, tx, rec) }); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, rec.ID)
+	}
+
+	all, err := repo.GetOutboxSince(ctx, start, uuid.Nil, 10, "hold", "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || all[0].ID != ids[0] || all[3].ID != ids[3] {
+		t.Fatalf("expected all records oldest first, got %+v", all)
+	}
+
+	// Records of one transaction share a created_at; paging one at a time
+	// from each returned record must still reach both.
+	batch := domain.NewHold(uuid.New(), []string{"C1", "C2"}, uuid.New(), 5*time.Minute)
 	err = repo.WithTx(ctx, func(tx pgx.Tx) error {
-		return repo.CreateHold(ctx, tx, hold)
+		if err := repo.InsertOutbox(ctx, tx, crdb.HoldOutboxRecord(batch, "hold.created")); err != nil {
+			return err
+		}
+		return repo.InsertOutbox(ctx, tx, crdb.HoldOutboxRecord(batch, "hold.released"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := all[3]
+	var paged []crdb.OutboxRecord
+	for {
+		page, err := repo.GetOutboxSince(ctx, last.CreatedAt, last.ID, 1, "hold", "order")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, page...)
+		last = page[0]
+	}
+	if len(paged) != 2 || !paged[0].CreatedAt.Equal(paged[1].CreatedAt) {
+		t.Errorf("expected both records of the transaction, got %+v", paged)
+	}
+
+	after, err := repo.GetSeatOutboxAfter(ctx, hold.EventID, ids[0], 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 2 || after[0].EventType != "hold.extended" || after[1].EventType != "hold.released" {
+		t.Errorf("expected the later records of the event only, got %+v", after)
+	}
+
+	if _, err := repo.GetSeatOutboxAfter(ctx, hold.EventID, uuid.New(), 10); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown id, got %v", err)
+	}
+}
+
+func TestRepository_SaveEvent(t *testing.T) {
+	ctx := context.Background()
+	repo := crdb.NewRepository(startOrderDB(t), crdb.RetryPolicy{})
+
+	sellable := func(seats ...string) []domain.EventSeat {
+		var out []domain.EventSeat
+		for _, seat := range seats {
+			out = append(out, domain.EventSeat{SeatNo: seat, Sellable: true})
+		}
+		return out
+	}
+	event := domain.Event{ID: uuid.New(), Title: "Concert", StartsAt: time.Now().Add(48 * time.Hour), Status: domain.EventDraft, Seats: sellable("A1", "A2", "A3")}
+	save := func(event domain.Event) (domain.EventStatus, error) {
+		var status domain.EventStatus
+		err := repo.WithTx(ctx, func(tx pgx.Tx) (err error) {
+			status, err = repo.SaveEvent(ctx, tx, event)
+			return err
+		})
+		return status, err
+	}
+	transition := func(to domain.EventStatus) error {
+		return repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.TransitionEvent(ctx, tx, event.ID, to) })
+	}
+
+	if status, err := save(event); err != nil || status != domain.EventDraft {
+		t.Fatalf("expected a draft, got %s, %v", status, err)
+	}
+	if err := transition(domain.EventPublished); err != nil {
+		t.Fatal(err)
+	}
+	if err := transition(domain.EventPublished); err != nil {
+		t.Errorf("expected repeating a transition to succeed, got %v", err)
+	}
+
+	hold := domain.NewHold(event.ID, []string{"A1"}, uuid.New(), 5*time.Minute)
+	if err := repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.CreateHold(ctx, tx, hold) }); err != nil {
+		t.Fatal(err)
+	}
+	event.Seats = sellable("A2", "B1")
+	var unavailable *domain.SeatsUnavailableError
+	if _, err := save(event); !errors.As(err, &unavailable) || len(unavailable.Seats) != 1 || unavailable.Seats[0] != "A1" {
+		t.Fatalf("expected A1 to be reported as held, got %v", err)
+	}
+
+	event.Seats = sellable("A1", "A2", "B1")
+	event.Status = domain.EventDraft
+	if status, err := save(event); err != nil || status != domain.EventPublished {
+		t.Fatalf("expected the stored status to be kept, got %s, %v", status, err)
+	}
+	inventory, err := repo.GetSeatInventory(ctx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inventory) != 3 || !inventory["A1"] || !inventory["B1"] {
+		t.Errorf("expected A3 to be dropped and B1 added, got %v", inventory)
+	}
+
+	// A1 was held once, so the hold still refers to it after it is dropped.
+	if err := repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.ReleaseHold(ctx, tx, hold.ID) }); err != nil {
+		t.Fatal(err)
+	}
+	event.Seats = sellable("A2", "B1")
+	if _, err := save(event); err != nil {
+		t.Fatal(err)
+	}
+	inventory, err = repo.GetSeatInventory(ctx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sellable, ok := inventory["A1"]; !ok || sellable || len(inventory) != 3 {
+		t.Errorf("expected A1 to be kept as unsellable, got %v", inventory)
+	}
+
+	if err := transition(domain.EventCancelled); err != nil {
+		t.Fatal(err)
+	}
+	if err := transition(domain.EventPublished); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("expected a cancelled event to stay cancelled, got %v", err)
+	}
+	if _, err := save(event); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("expected updating a cancelled event to conflict, got %v", err)
+	}
+}
+
+func TestRepository_CreateEvent(t *testing.T) {
+	ctx := context.Background()
+	repo := crdb.NewRepository(startOrderDB(t), crdb.RetryPolicy{})
+
+	event := domain.Event{
+		ID:       uuid.New(),
+		Title:    "Concert",
+		StartsAt: time.Now().Add(48 * time.Hour).Truncate(time.Microsecond),
+		Status:   domain.EventDraft,
+		Seats:    []domain.EventSeat{{SeatNo: "A1", Sellable: true}, {SeatNo: "A2", Sellable: false}},
+		Pools:    []domain.EventPool{{PoolID: "standing", Capacity: 100, Sellable: true}},
+	}
+	create := func(event domain.Event) (status domain.EventStatus, created bool, err error) {
+		err = repo.WithTx(ctx, func(tx pgx.Tx) error {
+			status, created, err = repo.CreateEvent(ctx, tx, event)
+			return err
+		})
+		return status, created, err
+	}
+
+	if status, created, err := create(event); err != nil || !created || status != domain.EventDraft {
+		t.Fatalf("expected a new draft, got %s %v %v", status, created, err)
+	}
+	if err := repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.TransitionEvent(ctx, tx, event.ID, domain.EventPublished) }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Repeating the create finds the same event and leaves it alone.
+	repeat := event
+	repeat.Seats = []domain.EventSeat{event.Seats[1], event.Seats[0]}
+	if status, created, err := create(repeat); err != nil || created || status != domain.EventPublished {
+		t.Errorf("expected the repeat to find the published event, got %s %v %v", status, created, err)
+	}
+
+	other := event
+	other.Title = "Another concert"
+	other.Seats = []domain.EventSeat{{SeatNo: "B1", Sellable: true}}
+	if _, _, err := create(other); !errors.Is(err, domain.ErrEventExists) || !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected ErrEventExists, got %v", err)
+	}
+	inventory, err := repo.GetSeatInventory(ctx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inventory) != 2 || !inventory["A1"] {
+		t.Errorf("expected the seats of the first event to be kept, got %v", inventory)
+	}
+}
+
+func TestRepository_PoolHolds(t *testing.T) {
+	ctx := context.Background()
+	pool := startOrderDB(t)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{MaxAttempts: 10})
+
+	event := domain.Event{ID: uuid.New(), Title: "Festival", Status: domain.EventPublished, Pools: []domain.EventPool{
+		{PoolID: "standing", Capacity: 10, Sellable: true},
+		{PoolID: "vip", Capacity: 2, Sellable: true},
+	}}
+	save := func(event domain.Event) error {
+		return repo.WithTx(ctx, func(tx pgx.Tx) error {
+			_, err := repo.SaveEvent(ctx, tx, event)
+			return err
+		})
+	}
+	hold := func(ttl time.Duration, pools ...domain.PoolQuantity) (domain.Hold, error) {
+		hold := domain.NewHold(event.ID, nil, uuid.New(), ttl)
+		hold.Pools = pools
+		return hold, repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.CreateHold(ctx, tx, hold) })
+	}
+	if err := save(event); err != nil {
+		t.Fatal(err)
+	}
+
+	// Twenty buyers race for ten standing admissions.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := hold(5*time.Minute, domain.PoolQuantity{Pool: "standing", Quantity: 1})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	held := 0
+	for err := range errs {
+		var unavailable *domain.PoolsUnavailableError
+		switch {
+		case err == nil:
+			held++
+		case errors.As(err, &unavailable):
+			if unavailable.Remaining["standing"] != 0 {
+				t.Errorf("expected no standing admissions left, got %v", unavailable.Remaining)
+			}
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if held != 10 {
+		t.Fatalf("expected exactly 10 holds, got %d", held)
+	}
+
+	lapsing, err := hold(time.Second, domain.PoolQuantity{Pool: "vip", Quantity: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hold(5*time.Minute, domain.PoolQuantity{Pool: "vip", Quantity: 1}); !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected vip to be sold out, got %v", err)
+	}
+	if _, err := hold(5*time.Minute, domain.PoolQuantity{Pool: "balcony", Quantity: 1}); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Fatalf("expected an unknown pool to be refused, got %v", err)
+	}
+	time.Sleep(time.Until(lapsing.ExpiresAt))
+
+	vip, err := hold(5*time.Minute, domain.PoolQuantity{Pool: "vip", Quantity: 2})
+	if err != nil {
+		t.Fatalf("expected a lapsed hold to free its admissions, got %v", err)
+	}
+	price := domain.NewMoney(5000, "EUR")
+	order, err := domain.NewOrder(vip, []domain.OrderItem{
+		{EventID: event.ID, Pool: "vip", Quantity: 2, Price: price, Breakdown: []domain.PriceComponent{{Kind: "BASE", Name: "ticket", Amount: price}}},
+	}, "EUR", "card")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.WithTx(ctx, func(tx pgx.Tx) error { return repo.CreateOrder(ctx, tx, order) }); err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := repo.GetOrder(ctx, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched.Items) != 1 || fetched.Items[0].Pool != "vip" || fetched.Items[0].Quantity != 2 || fetched.TotalAmount != domain.NewMoney(10000, "EUR") {
+		t.Errorf("expected 2 vip admissions totalling 100.00 EUR, got %+v", fetched)
+	}
+
+	pools, err := repo.GetPoolAvailability(ctx, event.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pools["standing"].Held != 10 || pools["standing"].Remaining() != 0 || pools["vip"].Held != 2 || pools["vip"].Sold != 0 {
+		t.Errorf("unexpected availability %+v", pools)
+	}
+
+	event.Pools = event.Pools[:1]
+	if err := save(event); !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected dropping a pool with an order to conflict, got %v", err)
+	}
+	if _, err := pool.Exec(ctx, `UPDATE orders SET status = 'CANCELLED' WHERE id = $1`, order.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := save(event); err != nil {
+		t.Fatal(err)
+	}
+	pools, err = repo.GetPoolAvailability(ctx, event.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vip, ok := pools["vip"]; !ok || vip.Sellable || vip.Held != 0 {
+		t.Errorf("expected vip to be kept as unsellable with nothing taken, got %+v", pools)
+	}
+}
+
+func TestRepository_TransitionOrder(t *testing.T) {
+	ctx := context.Background()
+	pool := startOrderDB(t)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{})
+
+	order := heldOrder(t, repo, 2)
+	err := repo.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := repo.CreateOrder(ctx, tx, order); err != nil {
+			return err
+		}
+		from, err := repo.TransitionOrder(ctx, tx, order.ID, domain.OrderAwaitingPayment, "payment requested")
+		if from != domain.OrderPending {
+			t.Errorf("expected the order to move from PENDING, got %s", from)
+		}
+		return err
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	// The payment is confirmed while the order is being expired: the expiry
+	// waits on the row lock and then finds the order already CONFIRMED.
+	confirm, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer confirm.Rollback(ctx)
+	if _, err := repo.TransitionOrder(ctx, confirm, order.ID, domain.OrderConfirmed, "payment succeeded"); err != nil {
+		t.Fatal(err)
+	}
+	expired := make(chan error, 1)
+	go func() {
+		expired <- repo.WithTx(ctx, func(tx pgx.Tx) error {
+			_, err := repo.TransitionOrder(ctx, tx, order.ID, domain.OrderExpired, "payment timed out")
+			return err
+		})
+	}()
+	time.Sleep(200 * time.Millisecond)
+	if err := confirm.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-expired; !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected the stale expiry to be refused, got %v", err)
+	}
+
+	fetched, err := repo.GetOrder(ctx, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.Status != domain.OrderConfirmed {
+		t.Errorf("expected the order to stay CONFIRMED, got %s", fetched.Status)
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT from_status || '>' || to_status || ':' || reason FROM order_status_history
+		WHERE order_id = $1 ORDER BY created_at
+	`, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"PENDING>AWAITING_PAYMENT:payment requested", "AWAITING_PAYMENT>CONFIRMED:payment succeeded"}
+	if fmt.Sprint(history) != fmt.Sprint(want) {
+		t.Errorf("expected history %v, got %v", want, history)
+	}
+
+	var payload []byte
+	err = pool.QueryRow(ctx, `
+		SELECT payload_json FROM outbox WHERE aggregate_id = $1 AND event_type = 'order.confirmed'
+	`, order.ID).Scan(&payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record struct {
+		EventID    uuid.UUID `json:"event_id"`
+		Seats      []string  `json:"seats"`
+		FromStatus string    `json:"from_status"`
+		Status     string    `json:"status"`
+	}
+	if err := json.Unmarshal(payload, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.EventID != order.Items[0].EventID || len(record.Seats) != 2 || record.FromStatus != "AWAITING_PAYMENT" || record.Status != "CONFIRMED" {
+		t.Errorf("expected order.confirmed for both seats, got %+v", record)
+	}
+	var expiredRecords int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM outbox WHERE aggregate_id = $1 AND event_type = 'order.expired'`, order.ID).Scan(&expiredRecords); err != nil {
+		t.Fatal(err)
+	}
+	if expiredRecords != 0 {
+		t.Errorf("expected no order.expired for a refused transition, got %d", expiredRecords)
+	}
+}
+
+func TestRepository_GetLapsedOrders(t *testing.T) {
+	ctx := context.Background()
+	pool := startOrderDB(t)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{})
+
+	order := heldOrder(t, repo, 1)
+	err := repo.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := repo.CreateOrder(ctx, tx, order); err != nil {
+			return err
+		}
+		_, err := repo.TransitionOrder(ctx, tx, order.ID, domain.OrderAwaitingPayment, "payment requested")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids, err := repo.GetLapsedOrders(ctx, time.Now().Add(-time.Minute), 10); err != nil || len(ids) != 0 {
+		t.Fatalf("expected no order to have lapsed yet, got %v %v", ids, err)
+	}
+	ids, err := repo.GetLapsedOrders(ctx, time.Now().Add(time.Minute), 10)
+	if err != nil || len(ids) != 1 || ids[0] != order.ID {
+		t.Fatalf("expected the unpaid order to have lapsed, got %v %v", ids, err)
+	}
+
 	err = repo.WithTx(ctx, func(tx pgx.Tx) error {
-		return repo.CreateOrder(ctx, tx, order)
+		_, err := repo.TransitionOrder(ctx, tx, order.ID, domain.OrderExpired, "payment timed out")
+		return err
 	})
 	if err != nil {
-		t.Fatalf("expected no error, got %v", err)
+		t.Fatal(err)
+	}
+	occupied, err := repo.GetSeatOccupancy(ctx, order.Items[0].EventID, time.Now())
+	if err != nil || len(occupied) != 0 {
+		t.Errorf("expected the seat of an expired order to be free, got %v %v", occupied, err)
+	}
+	if ids, err := repo.GetLapsedOrders(ctx, time.Now().Add(time.Minute), 10); err != nil || len(ids) != 0 {
+		t.Errorf("expected an expired order not to lapse again, got %v %v", ids, err)
+	}
+}
+
+// TestRepository_PaymentInbox runs payment callbacks the way the callback
+// handler does: the inbox row and the transition commit or roll back together.
+func TestRepository_PaymentInbox(t *testing.T) {
+	ctx := context.Background()
+	pool := startOrderDB(t)
+	repo := crdb.NewRepository(pool, crdb.RetryPolicy{})
+
+	order := heldOrder(t, repo, 1)
+	err := repo.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := repo.CreateOrder(ctx, tx, order); err != nil {
+			return err
+		}
+		_, err := repo.TransitionOrder(ctx, tx, order.ID, domain.OrderAwaitingPayment, "payment requested")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := func(txID string, status domain.OrderStatus) (bool, error) {
+		var fresh bool
+		err := repo.WithTx(ctx, func(tx pgx.Tx) error {
+			var err error
+			fresh, err = repo.InsertInbox(ctx, tx, "payment:"+txID+":"+string(status))
+			if err != nil || !fresh {
+				return err
+			}
+			_, err = repo.TransitionOrder(ctx, tx, order.ID, status, "payment "+txID)
+			return err
+		})
+		return fresh, err
+	}
+	inboxed := func(txID string, status domain.OrderStatus) int {
+		var n int
+		if err := pool.QueryRow(ctx, `SELECT count(*) FROM inbox WHERE message_id = $1`, "payment:"+txID+":"+string(status)).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if fresh, err := callback("tx1", domain.OrderConfirmed); err != nil || !fresh {
+		t.Fatalf("expected the first callback to be applied, got %v %v", fresh, err)
+	}
+	if fresh, err := callback("tx1", domain.OrderConfirmed); err != nil || fresh {
+		t.Errorf("expected the redelivery to be acknowledged without being applied, got %v %v", fresh, err)
+	}
+	var confirmations int
+	err = pool.QueryRow(ctx, `
+		SELECT count(*) FROM order_status_history WHERE order_id = $1 AND to_status = 'CONFIRMED'
+	`, order.ID).Scan(&confirmations)
+	if err != nil || confirmations != 1 {
+		t.Errorf("expected one confirmation, got %d %v", confirmations, err)
+	}
+
+	// A conflicting status for the same transaction, and a second charge on a
+	// paid order, are refused and leave no inbox row behind, so they are not
+	// taken for redeliveries when they are sent again.
+	for _, c := range []struct {
+		txID   string
+		status domain.OrderStatus
+	}{{"tx1", domain.OrderFailed}, {"tx2", domain.OrderConfirmed}} {
+		if _, err := callback(c.txID, c.status); !errors.Is(err, domain.ErrConflict) {
+			t.Errorf("%s %s: expected the transition to be refused, got %v", c.txID, c.status, err)
+		}
+		if n := inboxed(c.txID, c.status); n != 0 {
+			t.Errorf("%s %s: expected no inbox row, got %d", c.txID, c.status, n)
+		}
 	}
 
 	fetched, err := repo.GetOrder(ctx, order.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if fetched.Status != "PENDING" || len(fetched.Items) != 2 {
-		t.Errorf("expected order with 2 items and PENDING, got %v with %d items", fetched.Status, len(fetched.Items))
+	if fetched.Status != domain.OrderConfirmed {
+		t.Errorf("expected the order to stay CONFIRMED, got %s", fetched.Status)
 	}
 }
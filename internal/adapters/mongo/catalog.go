@@ -2,48 +2,116 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type CatalogRepository struct {
-	coll   *mongo.Collection
-	logger observability.Logger
+	coll    *mongo.Collection
+	venues  *mongo.Collection
+	layouts *mongo.Collection
+	logger  observability.Logger
 }
 
 func NewCatalogRepository(db *mongo.Database, logger observability.Logger) *CatalogRepository {
 	return &CatalogRepository{
-		coll:   db.Collection("events"),
-		logger: logger,
+		coll:    db.Collection("events"),
+		venues:  db.Collection("venues"),
+		layouts: db.Collection("layouts"),
+		logger:  logger,
 	}
 }
 
+// EventDoc is the catalog entry of an event. The JSON form is what the
+// admin API accepts and returns. An event with a LayoutID takes its seats
+// from that venue layout, priced by PriceZones and adjusted by Overrides;
+// Seats then holds the result. Pools are general admission areas sold by
+// quantity rather than by seat.
 type EventDoc struct {
-	ID          uuid.UUID `bson:"_id"`
-	Name        string    `bson:"name"`
-	Description string    `bson:"description"`
-	Venue       string    `bson:"venue"`
-	Date        time.Time `bson:"date"`
-	Seats       []SeatDoc `bson:"seats"`
-	CreatedAt   time.Time `bson:"created_at"`
-	UpdatedAt   time.Time `bson:"updated_at"`
+	ID          uuid.UUID          `bson:"_id" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description,omitempty"`
+	Venue       string             `bson:"venue" json:"venue,omitempty"`
+	Date        time.Time          `bson:"date" json:"date"`
+	Currency    string             `bson:"currency" json:"currency"`
+	Status      domain.EventStatus `bson:"status,omitempty" json:"status"`
+	LayoutID    *uuid.UUID         `bson:"layout_id,omitempty" json:"layout_id,omitempty"`
+	PriceZones  []PriceZoneDoc     `bson:"price_zones,omitempty" json:"price_zones,omitempty"`
+	Overrides   []SeatOverrideDoc  `bson:"overrides,omitempty" json:"overrides,omitempty"`
+	Seats       []SeatDoc          `bson:"seats" json:"seats"`
+	Pools       []PoolDoc          `bson:"pools,omitempty" json:"pools,omitempty"`
+	Pricing     PricingDoc         `bson:"pricing" json:"pricing"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
+// Prices, surcharges and flat fees are keyed by ISO currency code and held in
+// that currency's minor units; rates are in basis points.
 type SeatDoc struct {
-	Number    string  `bson:"number"`
-	Row       string  `bson:"row"`
-	Section   string  `bson:"section"`
-	Price     float64 `bson:"price"`
-	Available bool    `bson:"available"`
+	Number    string           `bson:"number" json:"number"`
+	Row       string           `bson:"row" json:"row,omitempty"`
+	Section   string           `bson:"section" json:"section,omitempty"`
+	Tier      string           `bson:"tier,omitempty" json:"tier,omitempty"`
+	Prices    map[string]int64 `bson:"prices" json:"prices"`
+	Available bool             `bson:"available" json:"available"`
+	// Coordinates and attributes come from the venue layout, whose price
+	// zone becomes the seat's tier.
+	X          float64  `bson:"x,omitempty" json:"x,omitempty"`
+	Y          float64  `bson:"y,omitempty" json:"y,omitempty"`
+	Attributes []string `bson:"attributes,omitempty" json:"attributes,omitempty"`
+	// State is projected from CockroachDB by the catalog projector; it is
+	// empty until the seat's first projection.
+	State domain.SeatState `bson:"state,omitempty" json:"state,omitempty"`
+}
+
+// PoolDoc is a general admission pool of an event. Its price per admission
+// is priced by tier like a seat's.
+type PoolDoc struct {
+	ID        string           `bson:"id" json:"id"`
+	Name      string           `bson:"name" json:"name"`
+	Tier      string           `bson:"tier,omitempty" json:"tier,omitempty"`
+	Capacity  int              `bson:"capacity" json:"capacity"`
+	Prices    map[string]int64 `bson:"prices" json:"prices"`
+	Available bool             `bson:"available" json:"available"`
+	// Remaining is projected from CockroachDB by the catalog projector; it
+	// is nil until the pool's first projection.
+	Remaining *int `bson:"remaining,omitempty" json:"remaining,omitempty"`
+}
+
+type PricingDoc struct {
+	Tiers     []TierRuleDoc `bson:"tiers,omitempty" json:"tiers,omitempty"`
+	Fees      []FeeDoc      `bson:"fees,omitempty" json:"fees,omitempty"`
+	TaxName   string        `bson:"tax_name,omitempty" json:"tax_name,omitempty"`
+	TaxRateBP int64         `bson:"tax_rate_bp,omitempty" json:"tax_rate_bp,omitempty"`
+}
+
+type TierRuleDoc struct {
+	Name         string           `bson:"name" json:"name"`
+	Section      string           `bson:"section,omitempty" json:"section,omitempty"`
+	Tier         string           `bson:"tier,omitempty" json:"tier,omitempty"`
+	MultiplierBP int64            `bson:"multiplier_bp,omitempty" json:"multiplier_bp,omitempty"`
+	Surcharge    map[string]int64 `bson:"surcharge,omitempty" json:"surcharge,omitempty"`
+}
+
+type FeeDoc struct {
+	Name      string           `bson:"name" json:"name"`
+	Flat      map[string]int64 `bson:"flat,omitempty" json:"flat,omitempty"`
+	PercentBP int64            `bson:"percent_bp,omitempty" json:"percent_bp,omitempty"`
 }
 
 func (c *CatalogRepository) GetEvent(ctx context.Context, id uuid.UUID) (*EventDoc, error) {
 	var event EventDoc
 	err := c.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, domain.ErrNotFound
+	}
 	if err != nil {
 		c.logger.Error("failed to get event", err)
 		return nil, err
@@ -74,3 +142,234 @@ func (c *CatalogRepository) UpdateEventAvailability(ctx context.Context, id uuid
 	}
 	return nil
 }
+
+// ReplaceEvent writes the whole catalog entry, creating it if needed, so a
+// write that failed after CockroachDB committed can simply be retried.
+func (c *CatalogRepository) ReplaceEvent(ctx context.Context, event EventDoc) error {
+	event.UpdatedAt = time.Now()
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = event.UpdatedAt
+	}
+	_, err := c.coll.ReplaceOne(ctx, bson.M{"_id": event.ID}, event, options.Replace().SetUpsert(true))
+	if err != nil {
+		c.logger.Error("failed to replace event", err)
+		return err
+	}
+	return nil
+}
+
+func (c *CatalogRepository) SetEventStatus(ctx context.Context, id uuid.UUID, status domain.EventStatus) error {
+	result, err := c.coll.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"status": status, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.logger.Error("failed to update event status", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// ListEvents returns events without their seats, soonest first. An empty
+// status matches every event.
+func (c *CatalogRepository) ListEvents(ctx context.Context, status domain.EventStatus, limit, offset int64) ([]EventDoc, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"seats": 0}).
+		SetLimit(limit).
+		SetSkip(offset)
+	cursor, err := c.coll.Find(ctx, filter, opts)
+	if err != nil {
+		c.logger.Error("failed to list events", err)
+		return nil, err
+	}
+	events := []EventDoc{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// SeatProjection is the part of a catalog seat owned by CockroachDB.
+type SeatProjection struct {
+	Available bool
+	State     domain.SeatState
+}
+
+// ProjectSeats writes the projection of each listed seat of an event. Each
+// seat is updated on its own, so a concurrent ReplaceEvent is never undone;
+// seats the document does not list are skipped.
+func (c *CatalogRepository) ProjectSeats(ctx context.Context, eventID uuid.UUID, seats map[string]SeatProjection) error {
+	if len(seats) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(seats))
+	for number, seat := range seats {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": eventID, "seats.number": number}).
+			SetUpdate(bson.M{"$set": bson.M{"seats.$.available": seat.Available, "seats.$.state": seat.State}}))
+	}
+	if _, err := c.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		c.logger.Error("failed to project seats", err)
+		return err
+	}
+	return nil
+}
+
+// PoolProjection is the part of a catalog pool owned by CockroachDB.
+type PoolProjection struct {
+	Available bool
+	Remaining int
+}
+
+// ProjectPools writes the projection of each listed pool of an event, the
+// way ProjectSeats does for seats.
+func (c *CatalogRepository) ProjectPools(ctx context.Context, eventID uuid.UUID, pools map[string]PoolProjection) error {
+	if len(pools) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(pools))
+	for id, pool := range pools {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": eventID, "pools.id": id}).
+			SetUpdate(bson.M{"$set": bson.M{"pools.$.available": pool.Available, "pools.$.remaining": pool.Remaining}}))
+	}
+	if _, err := c.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		c.logger.Error("failed to project pools", err)
+		return err
+	}
+	return nil
+}
+
+// EventSort orders SearchEvents results; ties are broken by id.
+type EventSort string
+
+const (
+	SortDate      EventSort = "date"
+	SortDateDesc  EventSort = "-date"
+	SortName      EventSort = "name"
+	SortRelevance EventSort = "relevance"
+)
+
+// EventQuery selects on-sale events for the storefront. Zero fields do not
+// filter. After continues a previous page.
+type EventQuery struct {
+	Text  string
+	From  time.Time
+	To    time.Time
+	Venue string
+	Sort  EventSort
+	After *EventCursor
+	Limit int64
+}
+
+// EventCursor is the position after the last event of a page: the sort key
+// and id of that event, or for relevance, which cannot be resumed by key,
+// the number of events already returned.
+type EventCursor struct {
+	Sort   EventSort `json:"s"`
+	Date   time.Time `json:"d"`
+	Name   string    `json:"n,omitempty"`
+	ID     uuid.UUID `json:"i"`
+	Offset int64     `json:"o,omitempty"`
+}
+
+// EnsureIndexes creates the catalog indexes; it is safe to call on every
+// start.
+func (c *CatalogRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := c.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "name", Value: "text"}, {Key: "venue", Value: "text"}, {Key: "description", Value: "text"}},
+			Options: options.Index().SetName("events_text").
+				SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "venue", Value: 5}, {Key: "description", Value: 1}}),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "date", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("events_status_date")},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("events_status_name")},
+		{Keys: bson.D{{Key: "venue", Value: 1}, {Key: "date", Value: 1}}, Options: options.Index().SetName("events_venue_date")},
+	})
+	if err == nil {
+		_, err = c.layouts.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "venue_id", Value: 1}, {Key: "created_at", Value: 1}}, Options: options.Index().SetName("layouts_venue"),
+		})
+	}
+	if err != nil {
+		c.logger.Error("failed to create catalog indexes", err)
+	}
+	return err
+}
+
+// SearchEvents returns up to q.Limit published events without their seats.
+func (c *CatalogRepository) SearchEvents(ctx context.Context, q EventQuery) ([]EventDoc, error) {
+	filter := bson.M{"status": bson.M{"$nin": bson.A{domain.EventDraft, domain.EventCancelled}}}
+	if q.Text != "" {
+		filter["$text"] = bson.M{"$search": q.Text}
+	}
+	if q.Venue != "" {
+		filter["venue"] = q.Venue
+	}
+	date := bson.M{}
+	if !q.From.IsZero() {
+		date["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		date["$lt"] = q.To
+	}
+	if len(date) > 0 {
+		filter["date"] = date
+	}
+
+	opts := options.Find().SetLimit(q.Limit)
+	projection := bson.M{"seats": 0}
+	switch q.Sort {
+	case SortRelevance:
+		projection["score"] = bson.M{"$meta": "textScore"}
+		opts.SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: 1}})
+		if q.After != nil {
+			opts.SetSkip(q.After.Offset)
+		}
+	case SortName:
+		opts.SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}})
+		if q.After != nil {
+			filter["$or"] = keysetAfter("name", q.After.Name, q.After.ID, "$gt")
+		}
+	case SortDateDesc:
+		opts.SetSort(bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}})
+		if q.After != nil {
+			filter["$or"] = keysetAfter("date", q.After.Date, q.After.ID, "$lt")
+		}
+	default:
+		opts.SetSort(bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}})
+		if q.After != nil {
+			filter["$or"] = keysetAfter("date", q.After.Date, q.After.ID, "$gt")
+		}
+	}
+	opts.SetProjection(projection)
+
+	cursor, err := c.coll.Find(ctx, filter, opts)
+	if err != nil {
+		c.logger.Error("failed to search events", err)
+		return nil, err
+	}
+	events := []EventDoc{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// keysetAfter matches documents that sort after (key, id) in the direction
+// of op.
+func keysetAfter(key string, value interface{}, id uuid.UUID, op string) bson.A {
+	return bson.A{
+		bson.M{key: bson.M{op: value}},
+		bson.M{key: value, "_id": bson.M{op: id}},
+	}
+}
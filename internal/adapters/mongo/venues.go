@@ -0,0 +1,128 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type VenueDoc struct {
+	ID        uuid.UUID `bson:"_id" json:"id"`
+	Name      string    `bson:"name" json:"name"`
+	Address   string    `bson:"address,omitempty" json:"address,omitempty"`
+	City      string    `bson:"city,omitempty" json:"city,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// LayoutDoc is one seating chart of a venue. Layouts are never changed once
+// imported: events copy the seats they use, so a changed chart is imported
+// as a new layout and events are moved to it by updating them.
+type LayoutDoc struct {
+	ID        uuid.UUID          `bson:"_id" json:"id"`
+	VenueID   uuid.UUID          `bson:"venue_id" json:"venue_id"`
+	Name      string             `bson:"name" json:"name"`
+	SeatCount int                `bson:"seat_count" json:"seat_count"`
+	Sections  []LayoutSectionDoc `bson:"sections,omitempty" json:"sections,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type LayoutSectionDoc struct {
+	Name string         `bson:"name" json:"name"`
+	Zone string         `bson:"zone,omitempty" json:"zone,omitempty"`
+	Rows []LayoutRowDoc `bson:"rows" json:"rows"`
+}
+
+type LayoutRowDoc struct {
+	Name  string          `bson:"name" json:"name"`
+	Seats []LayoutSeatDoc `bson:"seats" json:"seats"`
+}
+
+type LayoutSeatDoc struct {
+	Number     string   `bson:"number" json:"number"`
+	X          float64  `bson:"x" json:"x"`
+	Y          float64  `bson:"y" json:"y"`
+	Zone       string   `bson:"zone,omitempty" json:"zone,omitempty"`
+	Attributes []string `bson:"attributes,omitempty" json:"attributes,omitempty"`
+}
+
+// PriceZoneDoc prices the layout seats of an event that fall in the zone.
+type PriceZoneDoc struct {
+	Name   string           `bson:"name" json:"name"`
+	Prices map[string]int64 `bson:"prices" json:"prices"`
+}
+
+// SeatOverrideDoc changes the zone or availability of some layout seats for
+// one event: a whole section, a row of it, or the listed seats.
+type SeatOverrideDoc struct {
+	Section   string   `bson:"section,omitempty" json:"section,omitempty"`
+	Row       string   `bson:"row,omitempty" json:"row,omitempty"`
+	Seats     []string `bson:"seats,omitempty" json:"seats,omitempty"`
+	Zone      string   `bson:"zone,omitempty" json:"zone,omitempty"`
+	Available *bool    `bson:"available,omitempty" json:"available,omitempty"`
+}
+
+func (c *CatalogRepository) CreateVenue(ctx context.Context, venue VenueDoc) error {
+	if _, err := c.venues.InsertOne(ctx, venue); err != nil {
+		c.logger.Error("failed to create venue", err)
+		return err
+	}
+	return nil
+}
+
+func (c *CatalogRepository) GetVenue(ctx context.Context, id uuid.UUID) (*VenueDoc, error) {
+	var venue VenueDoc
+	err := c.venues.FindOne(ctx, bson.M{"_id": id}).Decode(&venue)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		c.logger.Error("failed to get venue", err)
+		return nil, err
+	}
+	return &venue, nil
+}
+
+func (c *CatalogRepository) CreateLayout(ctx context.Context, layout LayoutDoc) error {
+	if _, err := c.layouts.InsertOne(ctx, layout); err != nil {
+		c.logger.Error("failed to create layout", err)
+		return err
+	}
+	return nil
+}
+
+func (c *CatalogRepository) GetLayout(ctx context.Context, id uuid.UUID) (*LayoutDoc, error) {
+	var layout LayoutDoc
+	err := c.layouts.FindOne(ctx, bson.M{"_id": id}).Decode(&layout)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		c.logger.Error("failed to get layout", err)
+		return nil, err
+	}
+	return &layout, nil
+}
+
+// ListLayouts returns the layouts of a venue without their sections, oldest
+// first.
+func (c *CatalogRepository) ListLayouts(ctx context.Context, venueID uuid.UUID) ([]LayoutDoc, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetProjection(bson.M{"sections": 0})
+	cursor, err := c.layouts.Find(ctx, bson.M{"venue_id": venueID}, opts)
+	if err != nil {
+		c.logger.Error("failed to list layouts", err)
+		return nil, err
+	}
+	layouts := []LayoutDoc{}
+	if err := cursor.All(ctx, &layouts); err != nil {
+		return nil, err
+	}
+	return layouts, nil
+}
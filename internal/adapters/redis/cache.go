@@ -5,8 +5,51 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
 )
 
+// extendHoldLockScript sets KEYS[1] to ARGV[1] for ARGV[2] ms unless another
+// owner holds it.
+var extendHoldLockScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1
+`)
+
+var releaseHoldLocksScript = redis.NewScript(`
+local released = 0
+for _, key in ipairs(KEYS) do
+	if redis.call("GET", key) == ARGV[1] then
+		released = released + redis.call("DEL", key)
+	end
+end
+return released
+`)
+
+// lockSeatsScript sets every key to ARGV[1] for ARGV[2] ms if none of them
+// exist, and otherwise sets nothing and returns {index, remaining ms} pairs
+// for the taken keys.
+var lockSeatsScript = redis.NewScript(`
+local taken = {}
+for i, key in ipairs(KEYS) do
+	local ttl = redis.call("PTTL", key)
+	if ttl ~= -2 then
+		taken[#taken + 1] = i - 1
+		taken[#taken + 1] = ttl
+	end
+end
+if #taken > 0 then
+	return taken
+end
+for _, key in ipairs(KEYS) do
+	redis.call("SET", key, ARGV[1], "PX", ARGV[2])
+end
+return taken
+`)
+
 type Cache struct {
 	client *redis.Client
 }
@@ -19,8 +62,59 @@ func (c *Cache) Client() *redis.Client {
 	return c.client
 }
 
-func (c *Cache) SetHoldLock(ctx context.Context, eventID, seat string, userID string, ttl time.Duration) (bool, error) {
-	key := "hold:" + eventID + ":" + seat
-	res := c.client.SetNX(ctx, key, userID, ttl)
-	return res.Val(), res.Err()
+// holdLockKey hash-tags the event id so that all seat locks of an event
+// land in one Redis Cluster slot, which the multi-key scripts require.
+func holdLockKey(eventID, seat string) string {
+	return "hold:{" + eventID + "}:" + seat
+}
+
+func holdLockKeys(eventID string, seats []string) []string {
+	keys := make([]string, len(seats))
+	for i, seat := range seats {
+		keys[i] = holdLockKey(eventID, seat)
+	}
+	return keys
+}
+
+// Seat locks hold the id of the hold that took them, so a hold only ever
+// extends or releases its own locks, never those of a later hold of the
+// same user on the same seats.
+
+// LockSeats locks all seats for holdID or none of them. If any seat is
+// already locked it returns a SeatsUnavailableError naming those seats and
+// when their locks run out.
+func (c *Cache) LockSeats(ctx context.Context, eventID string, seats []string, holdID string, ttl time.Duration) error {
+	if len(seats) == 0 {
+		return nil
+	}
+	taken, err := lockSeatsScript.Run(ctx, c.client, holdLockKeys(eventID, seats), holdID, ttl.Milliseconds()).Int64Slice()
+	if err != nil || len(taken) == 0 {
+		return err
+	}
+	now := time.Now()
+	conflict := &domain.SeatsUnavailableError{HeldUntil: map[string]time.Time{}}
+	for i := 0; i+1 < len(taken); i += 2 {
+		seat := seats[taken[i]]
+		conflict.Seats = append(conflict.Seats, seat)
+		if taken[i+1] > 0 {
+			conflict.HeldUntil[seat] = now.Add(time.Duration(taken[i+1]) * time.Millisecond)
+		}
+	}
+	return conflict
+}
+
+// ExtendHoldLock resets the lock TTL for holdID, taking the lock again if it
+// has lapsed or been evicted. It reports false only when another hold has
+// the seat locked.
+func (c *Cache) ExtendHoldLock(ctx context.Context, eventID, seat string, holdID string, ttl time.Duration) (bool, error) {
+	n, err := extendHoldLockScript.Run(ctx, c.client, []string{holdLockKey(eventID, seat)}, holdID, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// ReleaseHoldLocks deletes the seat locks still owned by holdID.
+func (c *Cache) ReleaseHoldLocks(ctx context.Context, eventID string, seats []string, holdID string) error {
+	if len(seats) == 0 {
+		return nil
+	}
+	return releaseHoldLocksScript.Run(ctx, c.client, holdLockKeys(eventID, seats), holdID).Err()
 }
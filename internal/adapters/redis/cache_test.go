@@ -0,0 +1,97 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	redisclient "github.com/redis/go-redis/v9"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/redis"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func TestCache_ExtendHoldLock(t *testing.T) {
+	ctx := context.Background()
+	client := startRedis(t)
+	cache := redis.NewCache(client)
+
+	if err := cache.LockSeats(ctx, "e1", []string{"A1", "A2"}, "h1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := cache.ExtendHoldLock(ctx, "e1", "A1", "h1", 5*time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("expected the hold to extend its lock, got %v %v", ok, err)
+	}
+	if ttl := client.PTTL(ctx, "hold:{e1}:A1").Val(); ttl <= time.Minute {
+		t.Errorf("expected the lock TTL to be reset, got %v", ttl)
+	}
+
+	// A lock that was evicted while the hold is still active is taken again.
+	client.Del(ctx, "hold:{e1}:A2")
+	ok, err = cache.ExtendHoldLock(ctx, "e1", "A2", "h1", 5*time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("expected a lapsed lock to be taken again, got %v %v", ok, err)
+	}
+	if owner := client.Get(ctx, "hold:{e1}:A2").Val(); owner != "h1" {
+		t.Errorf("expected A2 to be locked by h1, got %q", owner)
+	}
+
+	ok, err = cache.ExtendHoldLock(ctx, "e1", "A1", "h2", 5*time.Minute)
+	if err != nil || ok {
+		t.Fatalf("expected a lock held by another hold to be refused, got %v %v", ok, err)
+	}
+	if owner := client.Get(ctx, "hold:{e1}:A1").Val(); owner != "h1" {
+		t.Errorf("expected A1 to stay locked by h1, got %q", owner)
+	}
+}
+
+func TestCache_ReleaseHoldLocks(t *testing.T) {
+	ctx := context.Background()
+	client := startRedis(t)
+	cache := redis.NewCache(client)
+
+	// h1 was released and h2 of the same user took the seat since.
+	if err := cache.LockSeats(ctx, "e1", []string{"A1"}, "h2", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.ReleaseHoldLocks(ctx, "e1", []string{"A1"}, "h1"); err != nil {
+		t.Fatal(err)
+	}
+	if owner := client.Get(ctx, "hold:{e1}:A1").Val(); owner != "h2" {
+		t.Errorf("expected releasing h1 to leave the lock of h2, got %q", owner)
+	}
+	if err := cache.ReleaseHoldLocks(ctx, "e1", []string{"A1"}, "h2"); err != nil {
+		t.Fatal(err)
+	}
+	if n := client.Exists(ctx, "hold:{e1}:A1").Val(); n != 0 {
+		t.Errorf("expected h2 to release its lock, got %d keys", n)
+	}
+}
+
+// startRedis starts Redis and returns a client on it; both are closed when
+// tb finishes.
+func startRedis(tb testing.TB) *redisclient.Client {
+	ctx := context.Background()
+	redisContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "redis:7",
+			ExposedPorts: []string{"6379/tcp"},
+			WaitingFor:   wait.ForExec([]string{"redis-cli", "ping"}),
+		},
+		Started: true,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { redisContainer.Terminate(ctx) })
+
+	addr, err := redisContainer.Endpoint(ctx, "")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	client := redisclient.NewClient(&redisclient.Options{Addr: addr})
+	tb.Cleanup(func() { client.Close() })
+	return client
+}
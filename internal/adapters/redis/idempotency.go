@@ -6,8 +6,22 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
 )
 
+// releaseIdempScript deletes an in-progress record only if it still carries
+// the caller's token, so a late release cannot drop a finished response or
+// another request's reservation.
+var releaseIdempScript = redis.NewScript(`
+local val = redis.call("GET", KEYS[1])
+if val and cjson.decode(val).Token == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Idempotency is the idempotency.Store used as the fast path in front of
+// the durable CockroachDB store.
 type Idempotency struct {
 	client *redis.Client
 }
@@ -16,12 +30,7 @@ func NewIdempotency(client *redis.Client) *Idempotency {
 	return &Idempotency{client: client}
 }
 
-type IdempResponse struct {
-	Status int
-	Result []byte
-}
-
-func (i *Idempotency) Get(ctx context.Context, key string) (*IdempResponse, error) {
+func (i *Idempotency) Get(ctx context.Context, key string) (*idempotency.Record, error) {
 	val, err := i.client.Get(ctx, "idemp:"+key).Bytes()
 	if err == redis.Nil {
 		return nil, nil
@@ -29,15 +38,27 @@ func (i *Idempotency) Get(ctx context.Context, key string) (*IdempResponse, erro
 	if err != nil {
 		return nil, err
 	}
-	var resp IdempResponse
-	err = json.Unmarshal(val, &resp)
-	return &resp, err
+	var rec idempotency.Record
+	err = json.Unmarshal(val, &rec)
+	return &rec, err
 }
 
-func (i *Idempotency) Set(ctx context.Context, key string, resp IdempResponse, ttl time.Duration) error {
-	data, err := json.Marshal(resp)
+func (i *Idempotency) Reserve(ctx context.Context, key string, rec idempotency.Record, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return false, err
+	}
+	return i.client.SetNX(ctx, "idemp:"+key, data, ttl).Result()
+}
+
+func (i *Idempotency) Set(ctx context.Context, key string, rec idempotency.Record, ttl time.Duration) error {
+	data, err := json.Marshal(rec)
 	if err != nil {
 		return err
 	}
 	return i.client.Set(ctx, "idemp:"+key, data, ttl).Err()
 }
+
+func (i *Idempotency) Release(ctx context.Context, key, token string) error {
+	return releaseIdempScript.Run(ctx, i.client, []string{"idemp:" + key}, token).Err()
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+type Identity struct {
+	Subject uuid.UUID
+	Roles   []Role
+	Scopes  []string
+	// ExpiresAt is the token's exp claim; long-lived connections end there.
+	ExpiresAt time.Time
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+	Scope string   `json:"scope"`
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+type Options struct {
+	// PublicKey is a PEM block, or a path to a file holding one.
+	PublicKey string
+	JWKSFile  string
+	Issuer    string
+	Audience  string
+	Leeway    time.Duration
+}
+
+// Verifier checks RS256/ES256 tokens against a static key or a local JWKS.
+type Verifier struct {
+	defaultKey crypto.PublicKey
+	keys       map[string]crypto.PublicKey
+	parser     *jwt.Parser
+}
+
+func NewVerifier(opts Options) (*Verifier, error) {
+	v := &Verifier{keys: map[string]crypto.PublicKey{}}
+
+	if opts.PublicKey != "" {
+		pemData := []byte(opts.PublicKey)
+		if !strings.HasPrefix(strings.TrimSpace(opts.PublicKey), "-----BEGIN") {
+			data, err := os.ReadFile(opts.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("read jwt public key: %w", err)
+			}
+			pemData = data
+		}
+		key, err := parsePEMPublicKey(pemData)
+		if err != nil {
+			return nil, err
+		}
+		v.defaultKey = key
+	}
+
+	if opts.JWKSFile != "" {
+		data, err := os.ReadFile(opts.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("read jwks: %w", err)
+		}
+		if v.keys, err = parseJWKS(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if v.defaultKey == nil && len(v.keys) == 0 {
+		return nil, errors.New("jwt: no public key or jwks configured")
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(opts.Leeway),
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+	v.parser = jwt.NewParser(parserOpts...)
+	return v, nil
+}
+
+func (v *Verifier) Verify(raw string) (Identity, error) {
+	var c claims
+	if _, err := v.parser.ParseWithClaims(raw, &c, v.keyFunc); err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	subject, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: subject is not a user id", ErrInvalidToken)
+	}
+	identity := Identity{Subject: subject, Scopes: strings.Fields(c.Scope)}
+	if c.ExpiresAt != nil {
+		identity.ExpiresAt = c.ExpiresAt.Time
+	}
+	for _, role := range c.Roles {
+		identity.Roles = append(identity.Roles, Role(role))
+	}
+	return identity, nil
+}
+
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+		if v.defaultKey == nil {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+	if v.defaultKey == nil {
+		return nil, errors.New("token has no key id")
+	}
+	return v.defaultKey, nil
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer ..." value.
+func BearerToken(header string) (string, error) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", ErrMissingToken
+	}
+	return strings.TrimSpace(token), nil
+}
@@ -0,0 +1,133 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/auth"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "EC", "kid": "ec-1", "use": "sig", "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+	}}})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := auth.NewVerifier(auth.Options{
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		JWKSFile:  jwksFile,
+		Issuer:    "issuer",
+		Audience:  "tro-api",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := uuid.New()
+	claims := func(mutate func(*jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		c := jwt.RegisteredClaims{
+			Subject:   subject.String(),
+			Issuer:    "issuer",
+			Audience:  jwt.ClaimStrings{"tro-api"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}
+		if mutate != nil {
+			mutate(&c)
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, key interface{}, kid string, c jwt.RegisteredClaims) string {
+		tok := jwt.NewWithClaims(method, c)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{name: "rs256 static key", token: sign(jwt.SigningMethodRS256, rsaKey, "", claims(nil)), ok: true},
+		{name: "es256 jwks key", token: sign(jwt.SigningMethodES256, ecKey, "ec-1", claims(nil)), ok: true},
+		{name: "expired", token: sign(jwt.SigningMethodRS256, rsaKey, "", claims(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		}))},
+		{name: "no expiry", token: sign(jwt.SigningMethodRS256, rsaKey, "", claims(func(c *jwt.RegisteredClaims) { c.ExpiresAt = nil }))},
+		{name: "wrong issuer", token: sign(jwt.SigningMethodRS256, rsaKey, "", claims(func(c *jwt.RegisteredClaims) { c.Issuer = "other" }))},
+		{name: "wrong audience", token: sign(jwt.SigningMethodRS256, rsaKey, "", claims(func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"other"} }))},
+		{name: "non-uuid subject", token: sign(jwt.SigningMethodRS256, rsaKey, "", claims(func(c *jwt.RegisteredClaims) { c.Subject = "alice" }))},
+		{name: "hs256 rejected", token: sign(jwt.SigningMethodHS256, []byte("secret"), "", claims(nil))},
+	}
+	for _, tt := range tests {
+		identity, err := verifier.Verify(tt.token)
+		if tt.ok {
+			if err != nil || identity.Subject != subject {
+				t.Errorf("%s: expected subject %s, got %v (%v)", tt.name, subject, identity.Subject, err)
+			}
+			continue
+		}
+		if !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("%s: expected invalid token, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestIdentity_Can(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity auth.Identity
+		perm     auth.Permission
+		want     bool
+	}{
+		{name: "no roles defaults to customer", identity: auth.Identity{}, perm: auth.PermHoldsCreate, want: true},
+		{name: "customer cannot hold for others", identity: auth.Identity{Roles: []auth.Role{auth.RoleCustomer}}, perm: auth.PermHoldsCreateAny},
+		{name: "box office holds for others", identity: auth.Identity{Roles: []auth.Role{auth.RoleBoxOffice}}, perm: auth.PermHoldsCreateAny, want: true},
+		{name: "box office cannot force release", identity: auth.Identity{Roles: []auth.Role{auth.RoleBoxOffice}}, perm: auth.PermHoldsForceRelease},
+		{name: "admin force releases", identity: auth.Identity{Roles: []auth.Role{auth.RoleAdmin}}, perm: auth.PermHoldsForceRelease, want: true},
+		{name: "only admin manages events", identity: auth.Identity{Roles: []auth.Role{auth.RoleBoxOffice}}, perm: auth.PermEventsManage},
+		{name: "scope grants a single permission", identity: auth.Identity{Scopes: []string{"events:manage"}}, perm: auth.PermEventsManage, want: true},
+		{name: "unknown role grants nothing", identity: auth.Identity{Roles: []auth.Role{"guest"}}, perm: auth.PermHoldsCreate},
+	}
+	for _, tt := range tests {
+		if got := tt.identity.Can(tt.perm); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
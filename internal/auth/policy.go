@@ -0,0 +1,58 @@
+package auth
+
+type Role string
+
+const (
+	RoleCustomer  Role = "customer"
+	RoleBoxOffice Role = "box_office"
+	RoleAdmin     Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermHoldsCreate       Permission = "holds:create"
+	PermHoldsCreateAny    Permission = "holds:create_any"
+	PermHoldsRead         Permission = "holds:read"
+	PermHoldsReadAny      Permission = "holds:read_any"
+	PermHoldsUpdate       Permission = "holds:update"
+	PermHoldsForceRelease Permission = "holds:force_release"
+	PermOrdersCreate      Permission = "orders:create"
+	PermOrdersRead        Permission = "orders:read"
+	PermOrdersReadAny     Permission = "orders:read_any"
+	PermEventsManage      Permission = "events:manage"
+)
+
+var customerPermissions = []Permission{
+	PermHoldsCreate, PermHoldsRead, PermHoldsUpdate, PermOrdersCreate, PermOrdersRead,
+}
+
+var rolePermissions = map[Role][]Permission{
+	RoleCustomer:  customerPermissions,
+	RoleBoxOffice: append([]Permission{PermHoldsCreateAny, PermHoldsReadAny}, customerPermissions...),
+	RoleAdmin: append([]Permission{
+		PermHoldsCreateAny, PermHoldsReadAny, PermHoldsForceRelease, PermOrdersReadAny, PermEventsManage,
+	}, customerPermissions...),
+}
+
+// Can reports whether any of the identity's roles, or one of its scopes,
+// grants perm. A token without roles is treated as a customer.
+func (id Identity) Can(perm Permission) bool {
+	for _, scope := range id.Scopes {
+		if Permission(scope) == perm {
+			return true
+		}
+	}
+	roles := id.Roles
+	if len(roles) == 0 {
+		roles = []Role{RoleCustomer}
+	}
+	for _, role := range roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
-	"time"
-
+	"errors"
+	"fmt"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,8 +18,173 @@ type Config struct {
 	RedisAddr    string
 	RabbitURL    string
 	JWTPublicKey string
+	JWTJWKSFile  string
+	JWTIssuer    string
+	JWTAudience  string
 	HoldTTL      time.Duration
+	HoldMaxTTL   time.Duration
 	OTLPEndpoint string
+
+	// TxMaxAttempts bounds how often a transaction is run before a
+	// serialization failure is returned to the caller.
+	TxMaxAttempts    int
+	TxRetryBaseDelay time.Duration
+	TxRetryMaxDelay  time.Duration
+
+	// PaymentWebhookSecrets are tried in order, so a new secret can be
+	// prepended while the provider still signs with the old one.
+	PaymentWebhookSecrets   []string
+	PaymentWebhookTolerance time.Duration
+	// PaymentTimeout is how long an order may await payment before the
+	// expiry worker expires it and its seats and admissions go back on sale.
+	PaymentTimeout time.Duration
+
+	// RateLimits is keyed by "METHOD /route/pattern"; routes without an
+	// entry use RateLimits["default"].
+	RateLimits     map[string]RateLimitPolicy
+	TrustedProxies []netip.Prefix
+
+	// IdempotencyTTLs overrides how long responses are kept for replay,
+	// keyed by "METHOD /route/pattern".
+	IdempotencyTTLs map[string]time.Duration
+
+	// WSMessageRate limits the messages a client may send on one box office
+	// WebSocket.
+	WSMessageRate RateLimit
+
+	// CatalogReconcileInterval is how often the catalog projector compares
+	// the Mongo catalog with CockroachDB.
+	CatalogReconcileInterval time.Duration
+	// MetricsAddr is where background workers serve /metrics.
+	MetricsAddr string
+}
+
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
+}
+
+type RateLimitPolicy struct {
+	User      RateLimit
+	IP        RateLimit
+	Algorithm string // sliding_window or token_bucket
+	FailMode  string // closed, open or local
+}
+
+const defaultRateLimits = "default=user:10/1m,ip:100/1m"
+
+// parseRateLimits reads "route=scope:N/period,...;route=..." where route is
+// "default" or "METHOD /pattern" and scope is user or ip. A route may also
+// set "algo:sliding_window|token_bucket" and "fail:closed|open|local".
+func parseRateLimits(spec string) (map[string]RateLimitPolicy, error) {
+	policies := map[string]RateLimitPolicy{}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, limits, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate limit %q: missing '='", entry)
+		}
+		policy := RateLimitPolicy{Algorithm: "sliding_window", FailMode: "local"}
+		for _, limit := range strings.Split(limits, ",") {
+			scope, value, ok := strings.Cut(strings.TrimSpace(limit), ":")
+			if !ok {
+				return nil, fmt.Errorf("rate limit %q: expected scope:N/period", limit)
+			}
+			switch scope {
+			case "algo":
+				if value != "sliding_window" && value != "token_bucket" {
+					return nil, fmt.Errorf("rate limit %q: unknown algorithm", limit)
+				}
+				policy.Algorithm = value
+				continue
+			case "fail":
+				if value != "closed" && value != "open" && value != "local" {
+					return nil, fmt.Errorf("rate limit %q: unknown fail mode", limit)
+				}
+				policy.FailMode = value
+				continue
+			}
+			rl, err := parseRate(value)
+			if err != nil {
+				return nil, fmt.Errorf("rate limit %q: %w", limit, err)
+			}
+			switch scope {
+			case "user":
+				policy.User = rl
+			case "ip":
+				policy.IP = rl
+			default:
+				return nil, fmt.Errorf("rate limit %q: unknown scope %q", limit, scope)
+			}
+		}
+		policies[strings.TrimSpace(route)] = policy
+	}
+	return policies, nil
+}
+
+// parseRate reads "N/period", e.g. "10/1m".
+func parseRate(value string) (RateLimit, error) {
+	n, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateLimit{}, errors.New("expected N/period")
+	}
+	rl := RateLimit{}
+	var err error
+	if rl.Limit, err = strconv.Atoi(n); err != nil || rl.Limit <= 0 {
+		return RateLimit{}, errors.New("invalid limit")
+	}
+	if rl.Period, err = time.ParseDuration(period); err != nil || rl.Period <= 0 {
+		return RateLimit{}, errors.New("invalid period")
+	}
+	return rl, nil
+}
+
+// parseIdempotencyTTLs reads "METHOD /pattern=duration;...".
+func parseIdempotencyTTLs(spec string) (map[string]time.Duration, error) {
+	ttls := map[string]time.Duration{}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("idempotency ttl %q: missing '='", entry)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("idempotency ttl %q: invalid duration", entry)
+		}
+		ttls[strings.TrimSpace(route)] = ttl
+	}
+	return ttls, nil
+}
+
+func parseTrustedProxies(spec string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
 }
 
 func Load() (*Config, error) {
@@ -26,13 +195,112 @@ func Load() (*Config, error) {
 		holdTTL = 5 * time.Minute
 	}
 
+	holdMaxTTL, _ := time.ParseDuration(os.Getenv("HOLD_MAX_TTL"))
+	if holdMaxTTL == 0 {
+		holdMaxTTL = 15 * time.Minute
+	}
+
+	txMaxAttempts, _ := strconv.Atoi(os.Getenv("DB_TX_MAX_ATTEMPTS"))
+	if txMaxAttempts <= 0 {
+		txMaxAttempts = 5
+	}
+
+	txRetryBaseDelay, _ := time.ParseDuration(os.Getenv("DB_TX_RETRY_BASE_DELAY"))
+	if txRetryBaseDelay == 0 {
+		txRetryBaseDelay = 20 * time.Millisecond
+	}
+
+	txRetryMaxDelay, _ := time.ParseDuration(os.Getenv("DB_TX_RETRY_MAX_DELAY"))
+	if txRetryMaxDelay == 0 {
+		txRetryMaxDelay = time.Second
+	}
+
+	webhookTolerance, _ := time.ParseDuration(os.Getenv("PAYMENT_WEBHOOK_TOLERANCE"))
+	if webhookTolerance == 0 {
+		webhookTolerance = 5 * time.Minute
+	}
+
+	paymentTimeout, _ := time.ParseDuration(os.Getenv("PAYMENT_TIMEOUT"))
+	if paymentTimeout == 0 {
+		paymentTimeout = 30 * time.Minute
+	}
+
+	var webhookSecrets []string
+	for _, secret := range strings.Split(os.Getenv("PAYMENT_WEBHOOK_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			webhookSecrets = append(webhookSecrets, secret)
+		}
+	}
+
+	rateLimitSpec := os.Getenv("RATE_LIMITS")
+	if rateLimitSpec == "" {
+		rateLimitSpec = defaultRateLimits
+	}
+	rateLimits, err := parseRateLimits(rateLimitSpec)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := rateLimits["default"]; !ok {
+		defaults, _ := parseRateLimits(defaultRateLimits)
+		rateLimits["default"] = defaults["default"]
+	}
+
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, err
+	}
+
+	idempotencyTTLs, err := parseIdempotencyTTLs(os.Getenv("IDEMPOTENCY_TTLS"))
+	if err != nil {
+		return nil, err
+	}
+
+	wsMessageRate := RateLimit{Limit: 20, Period: time.Second}
+	if spec := os.Getenv("WS_MESSAGE_RATE"); spec != "" {
+		if wsMessageRate, err = parseRate(spec); err != nil {
+			return nil, fmt.Errorf("ws message rate %q: %w", spec, err)
+		}
+	}
+
+	reconcileInterval, _ := time.ParseDuration(os.Getenv("CATALOG_RECONCILE_INTERVAL"))
+	if reconcileInterval == 0 {
+		reconcileInterval = 5 * time.Minute
+	}
+
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	if metricsAddr == "" {
+		metricsAddr = ":9100"
+	}
+
 	return &Config{
 		CRDBDSN:      os.Getenv("CRDB_DSN"),
 		MongoURI:     os.Getenv("MONGO_URI"),
 		RedisAddr:    os.Getenv("REDIS_ADDR"),
 		RabbitURL:    os.Getenv("RABBIT_URL"),
 		JWTPublicKey: os.Getenv("JWT_PUBLIC_KEY"),
+		JWTJWKSFile:  os.Getenv("JWT_JWKS_FILE"),
+		JWTIssuer:    os.Getenv("JWT_ISSUER"),
+		JWTAudience:  os.Getenv("JWT_AUDIENCE"),
 		HoldTTL:      holdTTL,
+		HoldMaxTTL:   holdMaxTTL,
 		OTLPEndpoint: os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+
+		TxMaxAttempts:    txMaxAttempts,
+		TxRetryBaseDelay: txRetryBaseDelay,
+		TxRetryMaxDelay:  txRetryMaxDelay,
+
+		PaymentWebhookSecrets:   webhookSecrets,
+		PaymentWebhookTolerance: webhookTolerance,
+		PaymentTimeout:          paymentTimeout,
+
+		RateLimits:     rateLimits,
+		TrustedProxies: trustedProxies,
+
+		IdempotencyTTLs: idempotencyTTLs,
+
+		WSMessageRate: wsMessageRate,
+
+		CatalogReconcileInterval: reconcileInterval,
+		MetricsAddr:              metricsAddr,
 	}, nil
 }
@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+// SeatState is how a seat is shown on an event's seat map.
+type SeatState string
+
+const (
+	SeatAvailable SeatState = "available"
+	SeatHeld      SeatState = "held"
+	SeatSold      SeatState = "sold"
+)
+
+// SeatOccupancy describes a seat that is not available.
+type SeatOccupancy struct {
+	State SeatState
+	// HeldUntil is when the hold on the seat lapses; zero for sold seats and
+	// seats of an order awaiting payment.
+	HeldUntil time.Time
+}
+
+// PoolAvailability is the state of a general admission pool: how many of
+// its Capacity admissions are held or sold.
+type PoolAvailability struct {
+	Capacity int
+	Held     int
+	Sold     int
+	Sellable bool
+}
+
+// Remaining is never negative, even when capacity has been lowered below
+// what was already taken.
+func (p PoolAvailability) Remaining() int {
+	if n := p.Capacity - p.Held - p.Sold; n > 0 {
+		return n
+	}
+	return 0
+}
@@ -6,24 +6,51 @@ import (
 	"github.com/google/uuid"
 )
 
+// Hold reserves named seats, admissions to general admission pools, or
+// both, until ExpiresAt.
 type Hold struct {
 	ID        uuid.UUID
 	EventID   uuid.UUID
 	Seats     []string
+	Pools     []PoolQuantity
 	UserID    uuid.UUID
+	Status    string
+	CreatedAt time.Time
 	ExpiresAt time.Time
 }
 
 type Order struct {
 	ID          uuid.UUID
 	UserID      uuid.UUID
-	Status      string
-	TotalAmount float64
+	HoldID      uuid.UUID
+	Status      OrderStatus
+	TotalAmount Money
 	Items       []OrderItem
 }
 
+// PoolQuantity is a number of admissions to one general admission pool.
+type PoolQuantity struct {
+	Pool     string
+	Quantity int
+}
+
+// OrderItem is either one seat or Quantity admissions to Pool. Price and
+// Breakdown are per ticket.
 type OrderItem struct {
-	EventID uuid.UUID
-	SeatNo  string
-	Price   float64
+	EventID   uuid.UUID
+	SeatNo    string
+	Pool      string
+	Quantity  int
+	Price     Money
+	Breakdown []PriceComponent
+}
+
+func (i OrderItem) Total() Money {
+	return Money{Amount: i.Price.Amount * int64(i.Quantity), Currency: i.Price.Currency}
+}
+
+type PriceComponent struct {
+	Kind   string
+	Name   string
+	Amount Money
 }
@@ -1,10 +1,81 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 var (
 	ErrSerializationFailure = errors.New("serialization failure")
 	ErrNotFound             = errors.New("not found")
 	ErrConflict             = errors.New("conflict")
 	ErrInvalidInput         = errors.New("invalid input")
+	ErrForbidden            = errors.New("forbidden")
+	ErrHoldExpired          = errors.New("hold expired")
+	ErrNotOnSale            = errors.New("event not on sale")
+	// ErrEventExists means a different event already has the id of an event
+	// being created. It matches ErrConflict.
+	ErrEventExists = fmt.Errorf("%w: a different event with this id exists", ErrConflict)
 )
+
+// SeatsUnavailableError lists the requested seats that are already taken.
+// It matches ErrConflict.
+type SeatsUnavailableError struct {
+	Seats []string
+	// HeldUntil is when the current hold on a seat lapses, where known.
+	HeldUntil map[string]time.Time
+}
+
+func (e *SeatsUnavailableError) Error() string {
+	return "seats unavailable: " + strings.Join(e.Seats, ", ")
+}
+
+func (e *SeatsUnavailableError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// PoolsUnavailableError lists the requested general admission pools that
+// cannot be taken. It matches ErrConflict.
+type PoolsUnavailableError struct {
+	Pools []string
+	// Remaining is how many admissions a pool still has, where known.
+	Remaining map[string]int
+}
+
+func (e *PoolsUnavailableError) Error() string {
+	return "pools unavailable: " + strings.Join(e.Pools, ", ")
+}
+
+func (e *PoolsUnavailableError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// PoolsNotForSaleError lists requested pools that are not sellable pools of
+// the event. It matches ErrInvalidInput.
+type PoolsNotForSaleError struct {
+	Pools []string
+}
+
+func (e *PoolsNotForSaleError) Error() string {
+	return "pools not for sale: " + strings.Join(e.Pools, ", ")
+}
+
+func (e *PoolsNotForSaleError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+// SeatsNotForSaleError lists requested seats that are not sellable seats of
+// the event. It matches ErrInvalidInput.
+type SeatsNotForSaleError struct {
+	Seats []string
+}
+
+func (e *SeatsNotForSaleError) Error() string {
+	return "seats not for sale: " + strings.Join(e.Seats, ", ")
+}
+
+func (e *SeatsNotForSaleError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventStatus string
+
+const (
+	EventDraft     EventStatus = "DRAFT"
+	EventPublished EventStatus = "PUBLISHED"
+	EventCancelled EventStatus = "CANCELLED"
+)
+
+var eventTransitions = map[EventStatus][]EventStatus{
+	EventDraft:     {EventPublished, EventCancelled},
+	EventPublished: {EventDraft, EventCancelled},
+}
+
+func (s EventStatus) CanTransitionTo(next EventStatus) bool {
+	for _, allowed := range eventTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// OnSale reports whether seats of the event can be held. Catalog entries
+// written before events had a status are treated as published.
+func (s EventStatus) OnSale() bool {
+	return s == EventPublished || s == ""
+}
+
+// ValidateEventTransition rejects any move the state machine does not allow.
+func ValidateEventTransition(from, to EventStatus) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: event cannot move from %s to %s", ErrConflict, from, to)
+	}
+	return nil
+}
+
+// Event is the inventory side of an event: what CockroachDB stores and
+// holds are checked against. Descriptions and prices live in the catalog.
+type Event struct {
+	ID       uuid.UUID
+	Title    string
+	StartsAt time.Time
+	Status   EventStatus
+	Seats    []EventSeat
+	Pools    []EventPool
+}
+
+// EventSeat is a seat of an event's inventory. Only sellable seats can be
+// held; a seat is kept but made unsellable when it has to stay for the
+// holds and orders that reference it.
+type EventSeat struct {
+	SeatNo   string
+	Sellable bool
+}
+
+// EventPool is a general admission pool of an event's inventory, sold by
+// quantity up to Capacity. Like seats, a pool that holds or orders refer to
+// is kept but made unsellable when it is dropped.
+type EventPool struct {
+	PoolID   string
+	Capacity int
+	Sellable bool
+}
@@ -0,0 +1,36 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+func TestValidateEventTransition(t *testing.T) {
+	tests := []struct {
+		from, to domain.EventStatus
+		ok       bool
+	}{
+		{from: domain.EventDraft, to: domain.EventPublished, ok: true},
+		{from: domain.EventPublished, to: domain.EventDraft, ok: true},
+		{from: domain.EventPublished, to: domain.EventCancelled, ok: true},
+		{from: domain.EventDraft, to: domain.EventCancelled, ok: true},
+		{from: domain.EventPublished, to: domain.EventPublished, ok: false},
+		{from: domain.EventCancelled, to: domain.EventPublished, ok: false},
+		{from: domain.EventCancelled, to: domain.EventDraft, ok: false},
+	}
+	for _, tt := range tests {
+		err := domain.ValidateEventTransition(tt.from, tt.to)
+		if tt.ok && err != nil {
+			t.Errorf("%s -> %s: unexpected error %v", tt.from, tt.to, err)
+		}
+		if !tt.ok && !errors.Is(err, domain.ErrConflict) {
+			t.Errorf("%s -> %s: expected conflict, got %v", tt.from, tt.to, err)
+		}
+	}
+
+	if !domain.EventPublished.OnSale() || !domain.EventStatus("").OnSale() || domain.EventDraft.OnSale() || domain.EventCancelled.OnSale() {
+		t.Error("only published events, and legacy ones without a status, are on sale")
+	}
+}
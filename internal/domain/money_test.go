@@ -0,0 +1,60 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		amount   int64
+		decimal  string
+	}{
+		{in: "12.34", currency: "USD", amount: 1234, decimal: "12.34"},
+		{in: "100", currency: "EUR", amount: 10000, decimal: "100.00"},
+		{in: "0.5", currency: "EUR", amount: 50, decimal: "0.50"},
+		{in: "-0.07", currency: "USD", amount: -7, decimal: "-0.07"},
+		{in: "1500", currency: "JPY", amount: 1500, decimal: "1500"},
+		{in: "1.2340", currency: "KWD", amount: 1234, decimal: "1.234"},
+	}
+	for _, tt := range tests {
+		m, err := domain.ParseMoney(tt.in, tt.currency)
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error %v", tt.in, tt.currency, err)
+		}
+		if m.Amount != tt.amount || m.Decimal() != tt.decimal {
+			t.Errorf("%s %s: expected %d (%s), got %d (%s)", tt.in, tt.currency, tt.amount, tt.decimal, m.Amount, m.Decimal())
+		}
+	}
+
+	for _, in := range []string{"1.001", "abc", "1e3"} {
+		if _, err := domain.ParseMoney(in, "USD"); !errors.Is(err, domain.ErrInvalidInput) {
+			t.Errorf("%s: expected invalid input, got %v", in, err)
+		}
+	}
+	if _, err := domain.ParseMoney("1", "usd"); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("expected invalid currency to be rejected, got %v", err)
+	}
+}
+
+func TestMoney_MulBP(t *testing.T) {
+	tests := []struct {
+		amount int64
+		bp     int64
+		want   int64
+	}{
+		{amount: 3333, bp: 1000, want: 333},
+		{amount: 3335, bp: 1000, want: 334},
+		{amount: -3335, bp: 1000, want: -334},
+		{amount: 5000, bp: 15000, want: 7500},
+	}
+	for _, tt := range tests {
+		if got := domain.NewMoney(tt.amount, "USD").MulBP(tt.bp); got.Amount != tt.want {
+			t.Errorf("%d x %dbp: expected %d, got %d", tt.amount, tt.bp, tt.want, got.Amount)
+		}
+	}
+}
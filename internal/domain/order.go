@@ -1,17 +1,65 @@
 package domain
 
-import "github.com/google/uuid"
+import (
+	"fmt"
 
-func NewOrder(eventID uuid.UUID, seats []string, userID uuid.UUID, paymentMethod string) Order {
-	items := make([]OrderItem, len(seats))
-	for i, seat := range seats {
-		items[i] = OrderItem{EventID: eventID, SeatNo: seat, Price: 0.0}
+	"github.com/google/uuid"
+)
+
+type OrderStatus string
+
+const (
+	OrderPending         OrderStatus = "PENDING"
+	OrderAwaitingPayment OrderStatus = "AWAITING_PAYMENT"
+	OrderConfirmed       OrderStatus = "CONFIRMED"
+	OrderFailed          OrderStatus = "FAILED"
+	OrderCancelled       OrderStatus = "CANCELLED"
+	OrderRefunded        OrderStatus = "REFUNDED"
+	OrderExpired         OrderStatus = "EXPIRED"
+)
+
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:         {OrderAwaitingPayment, OrderCancelled, OrderExpired},
+	OrderAwaitingPayment: {OrderConfirmed, OrderFailed, OrderCancelled, OrderExpired},
+	OrderConfirmed:       {OrderRefunded},
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+func (s OrderStatus) Terminal() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+// ValidateOrderTransition rejects any move the state machine does not allow.
+func ValidateOrderTransition(from, to OrderStatus) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: order cannot move from %s to %s", ErrConflict, from, to)
+	}
+	return nil
+}
+
+func NewOrder(hold Hold, items []OrderItem, currency, paymentMethod string) (Order, error) {
+	prices := make([]Money, len(items))
+	for i, item := range items {
+		prices[i] = item.Total()
+	}
+	total, err := Sum(currency, prices...)
+	if err != nil {
+		return Order{}, err
 	}
 	return Order{
 		ID:          uuid.New(),
-		UserID:      userID,
-		Status:      "PENDING",
-		TotalAmount: 0.0,
+		UserID:      hold.UserID,
+		HoldID:      hold.ID,
+		Status:      OrderPending,
+		TotalAmount: total,
 		Items:       items,
-	}
+	}, nil
 }
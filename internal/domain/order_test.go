@@ -0,0 +1,50 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+func TestValidateOrderTransition(t *testing.T) {
+	tests := []struct {
+		from, to domain.OrderStatus
+		ok       bool
+	}{
+		{from: domain.OrderPending, to: domain.OrderAwaitingPayment, ok: true},
+		{from: domain.OrderPending, to: domain.OrderConfirmed, ok: false},
+		{from: domain.OrderAwaitingPayment, to: domain.OrderConfirmed, ok: true},
+		{from: domain.OrderAwaitingPayment, to: domain.OrderFailed, ok: true},
+		{from: domain.OrderConfirmed, to: domain.OrderFailed, ok: false},
+		{from: domain.OrderConfirmed, to: domain.OrderRefunded, ok: true},
+		{from: domain.OrderFailed, to: domain.OrderConfirmed, ok: false},
+		{from: domain.OrderRefunded, to: domain.OrderRefunded, ok: false},
+	}
+	for _, tt := range tests {
+		err := domain.ValidateOrderTransition(tt.from, tt.to)
+		if tt.ok && err != nil {
+			t.Errorf("%s -> %s: unexpected error %v", tt.from, tt.to, err)
+		}
+		if !tt.ok && !errors.Is(err, domain.ErrConflict) {
+			t.Errorf("%s -> %s: expected conflict, got %v", tt.from, tt.to, err)
+		}
+	}
+}
+
+func TestNewOrder_Total(t *testing.T) {
+	hold := domain.NewHold(uuid.New(), []string{"A1"}, uuid.New(), time.Minute)
+	items := []domain.OrderItem{
+		{EventID: hold.EventID, SeatNo: "A1", Quantity: 1, Price: domain.NewMoney(5000, "EUR")},
+		{EventID: hold.EventID, Pool: "floor", Quantity: 3, Price: domain.NewMoney(2500, "EUR")},
+	}
+	order, err := domain.NewOrder(hold, items, "EUR", "card")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.TotalAmount != domain.NewMoney(12500, "EUR") {
+		t.Errorf("expected 125.00 EUR, got %v", order.TotalAmount)
+	}
+}
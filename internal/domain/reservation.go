@@ -1,17 +1,100 @@
 package domain
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 func NewHold(eventID uuid.UUID, seats []string, userID uuid.UUID, ttl time.Duration) Hold {
+	now := time.Now()
 	return Hold{
 		ID:        uuid.New(),
 		EventID:   eventID,
 		Seats:     seats,
 		UserID:    userID,
-		ExpiresAt: time.Now().Add(ttl),
+		Status:    "ACTIVE",
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
 	}
 }
+
+// ValidateSeats rejects an empty seat list and seats requested twice.
+func ValidateSeats(seats []string) error {
+	if len(seats) == 0 {
+		return fmt.Errorf("%w: no seats requested", ErrInvalidInput)
+	}
+	seen := make(map[string]bool, len(seats))
+	for _, seat := range seats {
+		if seat == "" {
+			return fmt.Errorf("%w: empty seat number", ErrInvalidInput)
+		}
+		if seen[seat] {
+			return fmt.Errorf("%w: seat %s requested twice", ErrInvalidInput, seat)
+		}
+		seen[seat] = true
+	}
+	return nil
+}
+
+// ValidatePools rejects pools without a name, quantities below one and
+// pools requested twice.
+func ValidatePools(pools []PoolQuantity) error {
+	seen := make(map[string]bool, len(pools))
+	for _, p := range pools {
+		if p.Pool == "" {
+			return fmt.Errorf("%w: empty pool", ErrInvalidInput)
+		}
+		if p.Quantity < 1 {
+			return fmt.Errorf("%w: quantity for pool %s must be at least 1", ErrInvalidInput, p.Pool)
+		}
+		if seen[p.Pool] {
+			return fmt.Errorf("%w: pool %s requested twice", ErrInvalidInput, p.Pool)
+		}
+		seen[p.Pool] = true
+	}
+	return nil
+}
+
+// ValidateHoldRequest accepts seats, pool admissions or both.
+func ValidateHoldRequest(seats []string, pools []PoolQuantity) error {
+	if len(pools) == 0 {
+		return ValidateSeats(seats)
+	}
+	if len(seats) > 0 {
+		if err := ValidateSeats(seats); err != nil {
+			return err
+		}
+	}
+	return ValidatePools(pools)
+}
+
+// CanConvert reports whether userID may turn the hold into an order at now.
+func (h Hold) CanConvert(userID uuid.UUID, now time.Time) error {
+	if h.UserID != userID {
+		return ErrForbidden
+	}
+	if !now.Before(h.ExpiresAt) {
+		return ErrHoldExpired
+	}
+	return nil
+}
+
+// Extend pushes the expiry out by d, never past CreatedAt+maxTTL.
+func (h Hold) Extend(d, maxTTL time.Duration, now time.Time) (time.Time, error) {
+	if d <= 0 {
+		return time.Time{}, ErrInvalidInput
+	}
+	if !now.Before(h.ExpiresAt) {
+		return time.Time{}, ErrHoldExpired
+	}
+	expiresAt := h.ExpiresAt.Add(d)
+	if limit := h.CreatedAt.Add(maxTTL); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	if !expiresAt.After(h.ExpiresAt) {
+		return time.Time{}, ErrConflict
+	}
+	return expiresAt, nil
+}
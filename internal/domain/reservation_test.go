@@ -0,0 +1,76 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+func TestValidateSeats(t *testing.T) {
+	tests := []struct {
+		seats []string
+		ok    bool
+	}{
+		{seats: []string{"A1", "A2"}, ok: true},
+		{seats: nil, ok: false},
+		{seats: []string{"A1", ""}, ok: false},
+		{seats: []string{"A1", "A2", "A1"}, ok: false},
+	}
+	for _, tt := range tests {
+		err := domain.ValidateSeats(tt.seats)
+		if tt.ok && err != nil {
+			t.Errorf("%v: unexpected error %v", tt.seats, err)
+		}
+		if !tt.ok && !errors.Is(err, domain.ErrInvalidInput) {
+			t.Errorf("%v: expected invalid input, got %v", tt.seats, err)
+		}
+	}
+}
+
+func TestSeatsUnavailableError(t *testing.T) {
+	var err error = &domain.SeatsUnavailableError{Seats: []string{"A1", "B2"}}
+	if !errors.Is(err, domain.ErrConflict) {
+		t.Error("expected seats unavailable to match ErrConflict")
+	}
+	if err.Error() != "seats unavailable: A1, B2" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+func TestValidateHoldRequest(t *testing.T) {
+	floor := []domain.PoolQuantity{{Pool: "floor", Quantity: 2}}
+	tests := []struct {
+		name  string
+		seats []string
+		pools []domain.PoolQuantity
+		ok    bool
+	}{
+		{name: "seats", seats: []string{"A1"}, ok: true},
+		{name: "pools", pools: floor, ok: true},
+		{name: "both", seats: []string{"A1"}, pools: floor, ok: true},
+		{name: "nothing", ok: false},
+		{name: "bad seats with pools", seats: []string{"A1", "A1"}, pools: floor, ok: false},
+		{name: "zero quantity", pools: []domain.PoolQuantity{{Pool: "floor"}}, ok: false},
+		{name: "empty pool", pools: []domain.PoolQuantity{{Quantity: 1}}, ok: false},
+		{name: "pool twice", pools: []domain.PoolQuantity{{Pool: "floor", Quantity: 1}, {Pool: "floor", Quantity: 3}}, ok: false},
+	}
+	for _, tt := range tests {
+		err := domain.ValidateHoldRequest(tt.seats, tt.pools)
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, domain.ErrInvalidInput) {
+			t.Errorf("%s: expected invalid input, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestPoolAvailability_Remaining(t *testing.T) {
+	if n := (domain.PoolAvailability{Capacity: 2000, Held: 150, Sold: 800}).Remaining(); n != 1050 {
+		t.Errorf("expected 1050 left, got %d", n)
+	}
+	if n := (domain.PoolAvailability{Capacity: 100, Sold: 120}).Remaining(); n != 0 {
+		t.Errorf("expected a pool over capacity to have none left, got %d", n)
+	}
+}
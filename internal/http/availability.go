@@ -0,0 +1,159 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+type seatAvailability struct {
+	SeatNo     string           `json:"seat_no"`
+	Section    string           `json:"section,omitempty"`
+	Row        string           `json:"row,omitempty"`
+	X          float64          `json:"x,omitempty"`
+	Y          float64          `json:"y,omitempty"`
+	Attributes []string         `json:"attributes,omitempty"`
+	State      domain.SeatState `json:"state"`
+	HeldUntil  *time.Time       `json:"held_until,omitempty"`
+}
+
+type poolAvailability struct {
+	Pool      string `json:"pool"`
+	Name      string `json:"name"`
+	Capacity  int    `json:"capacity"`
+	Remaining int    `json:"remaining"`
+	Held      int    `json:"held"`
+	Sold      int    `json:"sold"`
+}
+
+type availabilityResponse struct {
+	EventID uuid.UUID                `json:"event_id"`
+	Counts  map[domain.SeatState]int `json:"counts"`
+	Seats   []seatAvailability       `json:"seats"`
+	Pools   []poolAvailability       `json:"pools,omitempty"`
+}
+
+// GetAvailability returns the seat map of an event and what is left of its
+// general admission pools. The body is served with
+// a strong ETag so clients polling it only download changes.
+func (h *Handlers) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	eventID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
+		return
+	}
+
+	event, err := h.mongoCatalog.GetEvent(r.Context(), eventID)
+	if err != nil || event.Status == domain.EventDraft {
+		writeProblem(w, r, http.StatusNotFound, codeEventNotFound, "event not found")
+		return
+	}
+
+	inventory, err := h.repo.GetSeatInventory(r.Context(), eventID)
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	occupied, err := h.repo.GetSeatOccupancy(r.Context(), eventID, time.Now())
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	pools, err := h.repo.GetPoolAvailability(r.Context(), eventID, time.Now())
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	resp := buildAvailability(event, inventory, occupied, query.Get("section"), query.Get("row"))
+	resp.Pools = buildPoolAvailability(event, pools)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	etag := availabilityETag(data)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// buildAvailability lists the catalog seats that inventory has as sellable,
+// in catalog order, with their state taken from occupied. Empty section or
+// row match every seat.
+func buildAvailability(event *mongo.EventDoc, inventory map[string]bool, occupied map[string]domain.SeatOccupancy, section, row string) availabilityResponse {
+	resp := availabilityResponse{
+		EventID: event.ID,
+		Counts:  map[domain.SeatState]int{domain.SeatAvailable: 0, domain.SeatHeld: 0, domain.SeatSold: 0},
+		Seats:   []seatAvailability{},
+	}
+	for _, s := range event.Seats {
+		if !inventory[s.Number] || (section != "" && s.Section != section) || (row != "" && s.Row != row) {
+			continue
+		}
+		seat := seatAvailability{
+			SeatNo: s.Number, Section: s.Section, Row: s.Row,
+			X: s.X, Y: s.Y, Attributes: s.Attributes, State: domain.SeatAvailable,
+		}
+		if o, ok := occupied[s.Number]; ok {
+			seat.State = o.State
+			if !o.HeldUntil.IsZero() && o.State == domain.SeatHeld {
+				heldUntil := o.HeldUntil.UTC()
+				seat.HeldUntil = &heldUntil
+			}
+		}
+		resp.Counts[seat.State]++
+		resp.Seats = append(resp.Seats, seat)
+	}
+	return resp
+}
+
+// buildPoolAvailability lists the catalog pools that CockroachDB has as
+// sellable, in catalog order.
+func buildPoolAvailability(event *mongo.EventDoc, pools map[string]domain.PoolAvailability) []poolAvailability {
+	var out []poolAvailability
+	for _, p := range event.Pools {
+		pool, ok := pools[p.ID]
+		if !ok || !pool.Sellable {
+			continue
+		}
+		out = append(out, poolAvailability{
+			Pool: p.ID, Name: p.Name, Capacity: pool.Capacity,
+			Remaining: pool.Remaining(), Held: pool.Held, Sold: pool.Sold,
+		})
+	}
+	return out
+}
+
+func availabilityETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches implements the If-None-Match comparison, which is weak: a
+// W/ prefix on either side is ignored.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+func TestBuildAvailability(t *testing.T) {
+	until := time.Date(2026, 10, 16, 12, 5, 0, 0, time.UTC)
+	event := &mongo.EventDoc{
+		ID: uuid.New(),
+		Seats: []mongo.SeatDoc{
+			{Number: "A1", Section: "Main", Row: "A", Available: true},
+			{Number: "A2", Section: "Main", Row: "A", Available: true},
+			{Number: "A3", Section: "Main", Row: "A", Available: true},
+			{Number: "A4", Section: "Main", Row: "A", Available: true},
+			{Number: "B1", Section: "Main", Row: "B", Available: true},
+			{Number: "K1", Section: "Balcony", Row: "K", Available: true},
+		},
+	}
+	// CockroachDB decides what is on sale, whatever the catalog says.
+	inventory := map[string]bool{"A1": true, "A2": true, "A3": true, "A4": false, "B1": true, "K1": true}
+	occupied := map[string]domain.SeatOccupancy{
+		"A1": {State: domain.SeatHeld, HeldUntil: until},
+		"A2": {State: domain.SeatSold},
+		"K1": {State: domain.SeatSold},
+	}
+
+	resp := buildAvailability(event, inventory, occupied, "Main", "A")
+	if len(resp.Seats) != 3 {
+		t.Fatalf("expected A1-A3 only, got %+v", resp.Seats)
+	}
+	want := []domain.SeatState{domain.SeatHeld, domain.SeatSold, domain.SeatAvailable}
+	for i, seat := range resp.Seats {
+		if seat.State != want[i] {
+			t.Errorf("%s: expected %s, got %s", seat.SeatNo, want[i], seat.State)
+		}
+	}
+	if resp.Seats[0].HeldUntil == nil || !resp.Seats[0].HeldUntil.Equal(until) || resp.Seats[1].HeldUntil != nil {
+		t.Errorf("unexpected held_until: %v, %v", resp.Seats[0].HeldUntil, resp.Seats[1].HeldUntil)
+	}
+	if resp.Counts[domain.SeatAvailable] != 1 || resp.Counts[domain.SeatHeld] != 1 || resp.Counts[domain.SeatSold] != 1 {
+		t.Errorf("unexpected counts %v", resp.Counts)
+	}
+
+	if all := buildAvailability(event, inventory, occupied, "", ""); len(all.Seats) != 5 {
+		t.Errorf("expected every seat on sale without filters, got %d", len(all.Seats))
+	}
+}
+
+func TestBuildPoolAvailability(t *testing.T) {
+	event := &mongo.EventDoc{
+		ID: uuid.New(),
+		Pools: []mongo.PoolDoc{
+			{ID: "standing", Name: "Standing", Capacity: 500, Available: true},
+			{ID: "vip", Name: "VIP deck", Capacity: 20, Available: true},
+			{ID: "lawn", Name: "Lawn", Capacity: 100, Available: true},
+		},
+	}
+	pools := map[string]domain.PoolAvailability{
+		"standing": {Capacity: 500, Held: 40, Sold: 300, Sellable: true},
+		"vip":      {Capacity: 10, Sold: 12, Sellable: true},
+		"lawn":     {Capacity: 100},
+	}
+
+	got := buildPoolAvailability(event, pools)
+	want := []poolAvailability{
+		{Pool: "standing", Name: "Standing", Capacity: 500, Remaining: 160, Held: 40, Sold: 300},
+		{Pool: "vip", Name: "VIP deck", Capacity: 10, Remaining: 0, Sold: 12},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], got[i])
+		}
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := availabilityETag([]byte(`{"seats":[]}`))
+	if etag != availabilityETag([]byte(`{"seats":[]}`)) || etag == availabilityETag([]byte(`{"seats":null}`)) {
+		t.Fatal("etag must be derived from the body")
+	}
+	for header, want := range map[string]bool{
+		etag:               true,
+		"W/" + etag:        true,
+		`"other", ` + etag: true,
+		"*":                true,
+		`"other"`:          false,
+		"":                 false,
+	} {
+		if got := etagMatches(header, etag); got != want {
+			t.Errorf("If-None-Match %q: expected %v, got %v", header, want, got)
+		}
+	}
+}
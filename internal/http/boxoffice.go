@@ -0,0 +1,382 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/auth"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/rateLimit"
+)
+
+const (
+	wsWriteWait        = 10 * time.Second
+	wsPongWait         = 60 * time.Second
+	wsPingEvery        = wsPongWait * 9 / 10
+	wsMaxMessage       = 8 << 10
+	wsMaxSubscriptions = 50
+	wsSendBuffer       = 64
+)
+
+var wsUpgrader = websocket.Upgrader{ReadBufferSize: 4 << 10, WriteBufferSize: 4 << 10}
+
+// wsRequest is a message from the box office client. ID is chosen by the
+// client and echoed on the ack, conflict or error answering it.
+type wsRequest struct {
+	Type     string        `json:"type"`
+	ID       string        `json:"id"`
+	EventIDs []uuid.UUID   `json:"event_ids"`
+	EventID  uuid.UUID     `json:"event_id"`
+	Seats    []string      `json:"seats"`
+	Pools    []poolRequest `json:"pools"`
+	UserID   uuid.UUID     `json:"user_id"`
+	HoldID   uuid.UUID     `json:"hold_id"`
+}
+
+// boxOfficeSession is one box office socket. Requests are handled in order
+// on the reading goroutine; everything sent goes through out so that a single
+// goroutine writes to the connection.
+type boxOfficeSession struct {
+	h        *Handlers
+	r        *http.Request
+	rl       *rateLimit.RateLimiter
+	conn     *websocket.Conn
+	identity auth.Identity
+	key      string
+
+	out   chan interface{}
+	subs  map[uuid.UUID]func()
+	holds map[uuid.UUID]bool // placed on this socket
+}
+
+// BoxOffice upgrades to a WebSocket on which an operator subscribes to the
+// seat maps of several events and places or releases holds, receiving acks
+// and conflicts on the same socket. The socket is closed when the token
+// used to open it expires.
+func (h *Handlers) BoxOffice(rl *rateLimit.RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := auth.IdentityFrom(r.Context())
+		if !ok {
+			writeProblem(w, r, http.StatusUnauthorized, codeUnauthenticated, "unauthenticated")
+			return
+		}
+		conn, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return // the upgrader has already answered
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		s := &boxOfficeSession{
+			h:        h,
+			r:        r,
+			rl:       rl,
+			conn:     conn,
+			identity: identity,
+			key:      "ws:" + uuid.NewString(),
+			out:      make(chan interface{}, wsSendBuffer),
+			subs:     map[uuid.UUID]func(){},
+			holds:    map[uuid.UUID]bool{},
+		}
+		defer func() {
+			for _, unsubscribe := range s.subs {
+				unsubscribe()
+			}
+		}()
+
+		if !identity.ExpiresAt.IsZero() {
+			expiry := time.AfterFunc(time.Until(identity.ExpiresAt), func() {
+				msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token expired")
+				conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+				conn.Close()
+			})
+			defer expiry.Stop()
+		}
+
+		go s.writeLoop(ctx, cancel)
+		s.readLoop(ctx)
+	}
+}
+
+func (s *boxOfficeSession) readLoop(ctx context.Context) {
+	s.conn.SetReadLimit(wsMaxMessage)
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.sendError(ctx, "", codeInvalidRequest, "malformed message")
+			continue
+		}
+		if !s.allow(ctx, req) {
+			continue
+		}
+		s.handle(ctx, req)
+	}
+}
+
+func (s *boxOfficeSession) writeLoop(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+	ping := time.NewTicker(wsPingEvery)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-s.out:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := s.conn.WriteJSON(msg); err != nil {
+				s.conn.Close()
+				return
+			}
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				s.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// allow applies the per-socket message rate; the limiter's fail mode
+// decides what happens when Redis is down.
+func (s *boxOfficeSession) allow(ctx context.Context, req wsRequest) bool {
+	rate := s.h.cfg.WSMessageRate
+	if rate.Limit <= 0 {
+		return true
+	}
+	res, err := s.rl.Allow(ctx, s.key, rateLimit.Limit{
+		Rate:      rate.Limit,
+		Period:    rate.Period,
+		Algorithm: rateLimit.TokenBucket,
+		FailMode:  rateLimit.FailLocal,
+	})
+	if err != nil {
+		s.sendError(ctx, req.ID, codeUnavailable, "rate limiter unavailable")
+		return false
+	}
+	if !res.Allowed {
+		s.send(ctx, map[string]interface{}{
+			"type":           "error",
+			"id":             req.ID,
+			"code":           codeRateLimited,
+			"detail":         "rate limit exceeded",
+			"retry_after_ms": res.RetryAfter.Milliseconds(),
+		})
+		return false
+	}
+	return true
+}
+
+func (s *boxOfficeSession) handle(ctx context.Context, req wsRequest) {
+	switch req.Type {
+	case "subscribe":
+		s.subscribe(ctx, req)
+	case "unsubscribe":
+		for _, eventID := range req.EventIDs {
+			if unsubscribe, ok := s.subs[eventID]; ok {
+				unsubscribe()
+				delete(s.subs, eventID)
+			}
+		}
+		s.send(ctx, map[string]interface{}{"type": "ack", "id": req.ID, "event_ids": s.subscribed()})
+	case "hold":
+		s.hold(ctx, req)
+	case "release":
+		s.release(ctx, req)
+	default:
+		s.sendError(ctx, req.ID, codeInvalidRequest, "unknown message type "+req.Type)
+	}
+}
+
+// subscribe starts or restarts the subscriptions to req.EventIDs; a client
+// resubscribes after a reset.
+func (s *boxOfficeSession) subscribe(ctx context.Context, req wsRequest) {
+	if len(req.EventIDs) > wsMaxSubscriptions {
+		s.sendError(ctx, req.ID, codeInvalidRequest, "too many subscriptions")
+		return
+	}
+	var ids []uuid.UUID
+	added := 0
+	for _, eventID := range req.EventIDs {
+		if slices.Contains(ids, eventID) {
+			continue
+		}
+		ids = append(ids, eventID)
+		if _, ok := s.subs[eventID]; !ok {
+			added++
+			if _, err := s.h.mongoCatalog.GetEvent(ctx, eventID); err != nil {
+				s.sendError(ctx, req.ID, codeEventNotFound, "event "+eventID.String()+" not found")
+				return
+			}
+		}
+	}
+	if len(s.subs)+added > wsMaxSubscriptions {
+		s.sendError(ctx, req.ID, codeInvalidRequest, "too many subscriptions")
+		return
+	}
+	for _, eventID := range ids {
+		if unsubscribe, ok := s.subs[eventID]; ok {
+			unsubscribe()
+		}
+		s.subs[eventID] = s.forward(ctx, eventID)
+	}
+	s.send(ctx, map[string]interface{}{"type": "ack", "id": req.ID, "event_ids": s.subscribed()})
+}
+
+// forward relays the hub's seat changes for eventID. If the hub drops the
+// subscription because the socket fell behind, the client gets a "reset" and
+// should refetch the seat map and subscribe again.
+func (s *boxOfficeSession) forward(ctx context.Context, eventID uuid.UUID) func() {
+	updates, unsubscribe := s.h.hub.subscribe(eventID)
+	stopped := make(chan struct{})
+	go func() {
+		for ev := range updates {
+			msg := map[string]interface{}{
+				"type":      "seats",
+				"event_id":  ev.EventID,
+				"outbox_id": ev.ID,
+				"cause":     ev.Cause,
+				"seats":     ev.Seats,
+			}
+			if len(ev.Pools) > 0 {
+				msg["pools"] = ev.Pools
+			}
+			select {
+			case s.out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+		default:
+			s.send(ctx, map[string]interface{}{"type": "reset", "event_id": eventID})
+		}
+	}()
+	return func() {
+		close(stopped)
+		unsubscribe()
+	}
+}
+
+func (s *boxOfficeSession) subscribed() []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(s.subs))
+	for id := range s.subs {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	return ids
+}
+
+// hold places a tentative hold: an ordinary hold that lapses after HoldTTL
+// unless it is converted to an order. The operator may hold for a customer.
+func (s *boxOfficeSession) hold(ctx context.Context, req wsRequest) {
+	pools := poolQuantities(req.Pools)
+	if err := domain.ValidateHoldRequest(req.Seats, pools); err != nil {
+		s.sendError(ctx, req.ID, codeInvalidRequest, err.Error())
+		return
+	}
+	event, err := s.h.mongoCatalog.GetEvent(ctx, req.EventID)
+	if err != nil {
+		s.sendError(ctx, req.ID, codeEventNotFound, "event not found")
+		return
+	}
+	if !event.Status.OnSale() {
+		s.sendError(ctx, req.ID, codeEventNotOnSale, "event is not on sale")
+		return
+	}
+	userID := s.identity.Subject
+	if req.UserID != uuid.Nil {
+		userID = req.UserID
+	}
+
+	hold := domain.NewHold(req.EventID, req.Seats, userID, s.h.cfg.HoldTTL)
+	hold.Pools = pools
+	err = s.h.placeHold(ctx, hold)
+	var unavailable *domain.SeatsUnavailableError
+	var notForSale *domain.SeatsNotForSaleError
+	var poolsUnavailable *domain.PoolsUnavailableError
+	var poolsNotForSale *domain.PoolsNotForSaleError
+	switch {
+	case err == nil:
+		s.holds[hold.ID] = true
+		s.send(ctx, map[string]interface{}{"type": "ack", "id": req.ID, "hold": holdResponse(hold)})
+	case errors.As(err, &unavailable):
+		s.send(ctx, map[string]interface{}{
+			"type":     "conflict",
+			"id":       req.ID,
+			"code":     codeSeatsUnavailable,
+			"event_id": req.EventID,
+			"seats":    seatConflicts(unavailable),
+		})
+	case errors.As(err, &notForSale):
+		s.sendError(ctx, req.ID, codeSeatsNotForSale, notForSale.Error())
+	case errors.As(err, &poolsUnavailable):
+		s.send(ctx, map[string]interface{}{
+			"type":     "conflict",
+			"id":       req.ID,
+			"code":     codePoolsUnavailable,
+			"event_id": req.EventID,
+			"pools":    poolConflicts(poolsUnavailable),
+		})
+	case errors.As(err, &poolsNotForSale):
+		s.sendError(ctx, req.ID, codePoolsNotForSale, poolsNotForSale.Error())
+	case errors.Is(err, domain.ErrConflict), errors.Is(err, domain.ErrSerializationFailure):
+		s.sendError(ctx, req.ID, codeRetryConflict, "conflict, try again")
+	default:
+		s.sendError(ctx, req.ID, codeInternal, err.Error())
+	}
+}
+
+// release drops a hold of the operator or one placed on this socket; other
+// holds need the force-release permission.
+func (s *boxOfficeSession) release(ctx context.Context, req wsRequest) {
+	hold, err := s.h.releaseHold(ctx, req.HoldID, s.identity.Subject, func() bool {
+		return s.holds[req.HoldID] || s.h.policy.Allow(s.r, auth.PermHoldsForceRelease)
+	})
+	switch {
+	case err == nil:
+		delete(s.holds, hold.ID)
+		s.send(ctx, map[string]interface{}{"type": "ack", "id": req.ID, "hold": holdResponse(*hold)})
+	case errors.Is(err, domain.ErrNotFound):
+		s.sendError(ctx, req.ID, codeHoldNotFound, "hold not found")
+	case errors.Is(err, domain.ErrForbidden):
+		s.sendError(ctx, req.ID, codeForbidden, "hold belongs to another user")
+	case errors.Is(err, domain.ErrSerializationFailure):
+		s.sendError(ctx, req.ID, codeRetryConflict, "conflict, try again")
+	default:
+		s.sendError(ctx, req.ID, codeInternal, err.Error())
+	}
+}
+
+func (s *boxOfficeSession) send(ctx context.Context, msg interface{}) {
+	select {
+	case s.out <- msg:
+	case <-ctx.Done():
+	}
+}
+
+func (s *boxOfficeSession) sendError(ctx context.Context, id, code, detail string) {
+	s.send(ctx, map[string]interface{}{"type": "error", "id": id, "code": code, "detail": detail})
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/auth"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/config"
+)
+
+func dialBoxOffice(t *testing.T, identity auth.Identity) *websocket.Conn {
+	t.Helper()
+	h := &Handlers{cfg: &config.Config{}, hub: NewAvailabilityHub(nil, nil)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.BoxOffice(nil)(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestBoxOffice_Messages(t *testing.T) {
+	conn := dialBoxOffice(t, auth.Identity{Subject: uuid.New()})
+
+	tests := []struct {
+		send string
+		want map[string]interface{}
+	}{
+		{`{"type":"unsubscribe","id":"1","event_ids":["` + uuid.NewString() + `"]}`, map[string]interface{}{"type": "ack", "id": "1"}},
+		{`{"type":"dance","id":"2"}`, map[string]interface{}{"type": "error", "id": "2", "code": codeInvalidRequest}},
+		{`{"type":`, map[string]interface{}{"type": "error", "code": codeInvalidRequest}},
+		{`{"type":"hold","id":"3","seats":[]}`, map[string]interface{}{"type": "error", "id": "3", "code": codeInvalidRequest}},
+	}
+	for _, tt := range tests {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.send)); err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]interface{}
+		if err := conn.ReadJSON(&got); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("%s: expected %s=%v, got %v", tt.send, k, v, got)
+			}
+		}
+	}
+}
+
+func TestBoxOffice_ClosesWhenTokenExpires(t *testing.T) {
+	conn := dialBoxOffice(t, auth.Identity{Subject: uuid.New(), ExpiresAt: time.Now().Add(100 * time.Millisecond)})
+
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expected a policy violation close, got %v", err)
+	}
+}
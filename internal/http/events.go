@@ -0,0 +1,341 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
+)
+
+const (
+	defaultEventPageSize = 50
+	maxEventPageSize     = 200
+)
+
+// Event writes go to CockroachDB first, which owns the seat inventory and
+// status, and then to the Mongo catalog. Both are safe to repeat: an update
+// is an upsert, a transition to the status the event already has succeeds,
+// and the catalog write is a full replace. The Idempotency-Key claim is not
+// committed with the CockroachDB write, so when the catalog write fails the
+// 500 releases the key, and repeating the request under it writes the same
+// event again. A created event's id is derived from the key for that; the
+// create never overwrites an event, so a key reused for a different event
+// is refused.
+
+// eventIDSpace is the namespace of event ids derived from Idempotency-Keys.
+var eventIDSpace = uuid.MustParse("67b631e4-0538-45fd-a714-bea77a371e8f")
+
+// createdEventID is the id of the event created by the request in ctx, the
+// same on every attempt under one Idempotency-Key.
+func createdEventID(ctx context.Context) uuid.UUID {
+	if claim, ok := idempotency.ClaimFrom(ctx); ok {
+		return uuid.NewSHA1(eventIDSpace, []byte(claim.Key))
+	}
+	return uuid.New()
+}
+
+func (h *Handlers) CreateEvent(w http.ResponseWriter, r *http.Request) {
+	var doc mongo.EventDoc
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	doc.ID = createdEventID(r.Context())
+	doc.Status = domain.EventDraft
+	doc.CreatedAt, doc.UpdatedAt = time.Time{}, time.Time{}
+	if !h.prepareEventDoc(w, r, &doc) {
+		return
+	}
+
+	if !h.saveEvent(w, r, &doc, true) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
+
+// UpdateEvent replaces an event's details and seats; the status only changes
+// through publish, unpublish and cancel. An event with a layout gets its
+// seats from the layout again, so seats sent with it are ignored.
+func (h *Handlers) UpdateEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
+		return
+	}
+	existing, err := h.mongoCatalog.GetEvent(r.Context(), id)
+	if err != nil {
+		writeEventLookupError(w, r, err)
+		return
+	}
+
+	var doc mongo.EventDoc
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	doc.ID = id
+	doc.Status = existing.Status
+	if doc.Status == "" {
+		doc.Status = domain.EventPublished
+	}
+	doc.CreatedAt = existing.CreatedAt
+	if !h.prepareEventDoc(w, r, &doc) {
+		return
+	}
+
+	if !h.saveEvent(w, r, &doc, false) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// prepareEventDoc fills in the seats of an event that uses a venue layout
+// and validates the result, writing the problem response if either fails.
+func (h *Handlers) prepareEventDoc(w http.ResponseWriter, r *http.Request, doc *mongo.EventDoc) bool {
+	err := h.applyLayout(r.Context(), doc)
+	if err == nil {
+		err = validateEventDoc(*doc)
+	}
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, domain.ErrInvalidInput):
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	default:
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	return false
+}
+
+// saveEvent creates or updates doc in both stores and writes the problem
+// response if that fails. doc.Status is set to the status CockroachDB holds.
+func (h *Handlers) saveEvent(w http.ResponseWriter, r *http.Request, doc *mongo.EventDoc, create bool) bool {
+	event := domain.Event{ID: doc.ID, Title: doc.Name, StartsAt: doc.Date, Status: doc.Status}
+	for _, seat := range doc.Seats {
+		event.Seats = append(event.Seats, domain.EventSeat{SeatNo: seat.Number, Sellable: seat.Available})
+	}
+	for _, pool := range doc.Pools {
+		event.Pools = append(event.Pools, domain.EventPool{PoolID: pool.ID, Capacity: pool.Capacity, Sellable: pool.Available})
+	}
+
+	ctx := idempotency.WithoutClaim(r.Context())
+	err := h.repo.WithTx(ctx, func(tx pgx.Tx) error {
+		var status domain.EventStatus
+		var err error
+		eventType, written := "event.updated", true
+		if create {
+			eventType = "event.created"
+			status, written, err = h.repo.CreateEvent(ctx, tx, event)
+		} else {
+			status, err = h.repo.SaveEvent(ctx, tx, event)
+		}
+		if err != nil {
+			return err
+		}
+		doc.Status = status
+		if !written {
+			// A repeated create; its record was written the first time.
+			return nil
+		}
+		return h.repo.InsertOutbox(ctx, tx, crdb.EventOutboxRecord(doc.ID, status, eventType))
+	})
+	if err == nil {
+		err = h.mongoCatalog.ReplaceEvent(ctx, *doc)
+	}
+
+	var unavailable *domain.SeatsUnavailableError
+	var poolsUnavailable *domain.PoolsUnavailableError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &unavailable):
+		writeSeatsUnavailable(w, r, unavailable)
+	case errors.As(err, &poolsUnavailable):
+		writePoolsUnavailable(w, r, poolsUnavailable)
+	case errors.Is(err, domain.ErrSerializationFailure):
+		writeProblem(w, r, http.StatusConflict, codeRetryConflict, "conflict, try again")
+	case errors.Is(err, domain.ErrEventExists):
+		writeProblem(w, r, http.StatusUnprocessableEntity, codeIdempotencyKeyReused, "Idempotency-Key was already used to create a different event")
+	case errors.Is(err, domain.ErrConflict):
+		writeProblem(w, r, http.StatusConflict, codeTransitionNotAllowed, "cancelled events cannot be changed")
+	default:
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+	}
+	return false
+}
+
+func (h *Handlers) ListEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := domain.EventStatus(query.Get("status"))
+	switch status {
+	case "", domain.EventDraft, domain.EventPublished, domain.EventCancelled:
+	default:
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "unknown status "+string(status))
+		return
+	}
+	limit, err := queryInt(query.Get("limit"), defaultEventPageSize)
+	if err != nil || limit < 1 || limit > maxEventPageSize {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxEventPageSize))
+		return
+	}
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "offset must not be negative")
+		return
+	}
+
+	events, err := h.mongoCatalog.ListEvents(r.Context(), status, int64(limit), int64(offset))
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"events": events})
+}
+
+func (h *Handlers) GetEventAdmin(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
+		return
+	}
+	event, err := h.mongoCatalog.GetEvent(r.Context(), id)
+	if err != nil {
+		writeEventLookupError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
+
+// TransitionEvent returns the handler that publishes, unpublishes or
+// cancels an event. Repeating it after the catalog write failed writes the
+// status to the catalog again.
+func (h *Handlers) TransitionEvent(to domain.EventStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
+			return
+		}
+
+		ctx := idempotency.WithoutClaim(r.Context())
+		err = h.repo.WithTx(ctx, func(tx pgx.Tx) error {
+			return h.repo.TransitionEvent(ctx, tx, id, to)
+		})
+		if err == nil {
+			err = h.mongoCatalog.SetEventStatus(ctx, id, to)
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, domain.ErrNotFound):
+			writeProblem(w, r, http.StatusNotFound, codeEventNotFound, "event not found")
+			return
+		case errors.Is(err, domain.ErrSerializationFailure):
+			writeProblem(w, r, http.StatusConflict, codeRetryConflict, "conflict, try again")
+			return
+		case errors.Is(err, domain.ErrConflict):
+			writeProblem(w, r, http.StatusConflict, codeTransitionNotAllowed, err.Error())
+			return
+		default:
+			writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+
+		event, err := h.mongoCatalog.GetEvent(r.Context(), id)
+		if err != nil {
+			writeEventLookupError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(event)
+	}
+}
+
+func writeEventLookupError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, domain.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, codeEventNotFound, "event not found")
+		return
+	}
+	writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+}
+
+// validateEventDoc checks what the admin API accepts: a name, a date, a
+// known currency, uniquely numbered seats and uniquely named pools, those on
+// sale priced in that currency.
+func validateEventDoc(doc mongo.EventDoc) error {
+	if doc.Name == "" {
+		return fmt.Errorf("%w: name is required", domain.ErrInvalidInput)
+	}
+	if doc.Date.IsZero() {
+		return fmt.Errorf("%w: date is required", domain.ErrInvalidInput)
+	}
+	if !domain.ValidCurrency(doc.Currency) {
+		return fmt.Errorf("%w: currency %q", domain.ErrInvalidInput, doc.Currency)
+	}
+	if err := validatePools(doc); err != nil {
+		return err
+	}
+	if len(doc.Seats) == 0 {
+		return nil
+	}
+	numbers := make([]string, len(doc.Seats))
+	for i, seat := range doc.Seats {
+		numbers[i] = seat.Number
+		if _, ok := seat.Prices[doc.Currency]; !ok && seat.Available {
+			return fmt.Errorf("%w: seat %s has no %s price", domain.ErrInvalidInput, seat.Number, doc.Currency)
+		}
+		for currency, amount := range seat.Prices {
+			if amount < 0 || !domain.ValidCurrency(currency) {
+				return fmt.Errorf("%w: seat %s has an invalid %s price", domain.ErrInvalidInput, seat.Number, currency)
+			}
+		}
+	}
+	return domain.ValidateSeats(numbers)
+}
+
+func validatePools(doc mongo.EventDoc) error {
+	seen := make(map[string]bool, len(doc.Pools))
+	for _, pool := range doc.Pools {
+		if pool.ID == "" {
+			return fmt.Errorf("%w: pool id is required", domain.ErrInvalidInput)
+		}
+		if seen[pool.ID] {
+			return fmt.Errorf("%w: duplicate pool %s", domain.ErrInvalidInput, pool.ID)
+		}
+		seen[pool.ID] = true
+		if pool.Capacity < 0 {
+			return fmt.Errorf("%w: pool %s has a negative capacity", domain.ErrInvalidInput, pool.ID)
+		}
+		if _, ok := pool.Prices[doc.Currency]; !ok && pool.Available {
+			return fmt.Errorf("%w: pool %s has no %s price", domain.ErrInvalidInput, pool.ID, doc.Currency)
+		}
+		for currency, amount := range pool.Prices {
+			if amount < 0 || !domain.ValidCurrency(currency) {
+				return fmt.Errorf("%w: pool %s has an invalid %s price", domain.ErrInvalidInput, pool.ID, currency)
+			}
+		}
+	}
+	return nil
+}
+
+func queryInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
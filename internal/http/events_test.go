@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
+)
+
+func TestValidateEventDoc(t *testing.T) {
+	valid := func() mongo.EventDoc {
+		return mongo.EventDoc{
+			Name:     "Concert",
+			Date:     time.Date(2026, 12, 1, 20, 0, 0, 0, time.UTC),
+			Currency: "USD",
+			Seats: []mongo.SeatDoc{
+				{Number: "A1", Available: true, Prices: map[string]int64{"USD": 5000}},
+				{Number: "A2", Available: true, Prices: map[string]int64{"USD": 5000, "EUR": 4600}},
+			},
+			Pools: []mongo.PoolDoc{
+				{ID: "standing", Name: "Standing", Capacity: 500, Available: true, Prices: map[string]int64{"USD": 3000}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*mongo.EventDoc)
+		ok     bool
+	}{
+		{name: "valid", modify: func(*mongo.EventDoc) {}, ok: true},
+		{name: "no seats yet", modify: func(d *mongo.EventDoc) { d.Seats, d.Pools = nil, nil }, ok: true},
+		{name: "missing name", modify: func(d *mongo.EventDoc) { d.Name = "" }},
+		{name: "missing date", modify: func(d *mongo.EventDoc) { d.Date = time.Time{} }},
+		{name: "unknown currency", modify: func(d *mongo.EventDoc) { d.Currency = "usd" }},
+		{name: "duplicate seat", modify: func(d *mongo.EventDoc) { d.Seats[1].Number = "A1" }},
+		{name: "empty seat number", modify: func(d *mongo.EventDoc) { d.Seats[0].Number = "" }},
+		{name: "no price in event currency", modify: func(d *mongo.EventDoc) { d.Seats[0].Prices = map[string]int64{"EUR": 4600} }},
+		{name: "unpriced seat off sale", modify: func(d *mongo.EventDoc) { d.Seats[0].Prices, d.Seats[0].Available = nil, false }, ok: true},
+		{name: "negative price", modify: func(d *mongo.EventDoc) { d.Seats[1].Prices["EUR"] = -1 }},
+		{name: "pools only", modify: func(d *mongo.EventDoc) { d.Seats = nil }, ok: true},
+		{name: "empty pool id", modify: func(d *mongo.EventDoc) { d.Pools[0].ID = "" }},
+		{name: "duplicate pool", modify: func(d *mongo.EventDoc) { d.Pools = append(d.Pools, d.Pools[0]) }},
+		{name: "negative capacity", modify: func(d *mongo.EventDoc) { d.Pools[0].Capacity = -1 }},
+		{name: "unpriced pool", modify: func(d *mongo.EventDoc) { d.Pools[0].Prices = nil }},
+		{name: "unpriced pool off sale", modify: func(d *mongo.EventDoc) { d.Pools[0].Prices, d.Pools[0].Available = nil, false }, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := valid()
+			tt.modify(&doc)
+			err := validateEventDoc(doc)
+			if tt.ok && err != nil {
+				t.Fatalf("expected valid, got %v", err)
+			}
+			if !tt.ok && !errors.Is(err, domain.ErrInvalidInput) {
+				t.Fatalf("expected ErrInvalidInput, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCreatedEventID(t *testing.T) {
+	attempt := func(key string) context.Context {
+		return idempotency.WithClaim(context.Background(), &idempotency.Claim{Key: key, Token: "t"})
+	}
+	first := createdEventID(attempt("create-event-0001"))
+	if retry := createdEventID(attempt("create-event-0001")); retry != first {
+		t.Fatalf("expected a retry under the same key to create the same event, got %s and %s", first, retry)
+	}
+	if other := createdEventID(attempt("create-event-0002")); other == first {
+		t.Error("expected another key to create another event")
+	}
+	if createdEventID(context.Background()) == createdEventID(context.Background()) {
+		t.Error("expected random ids without an Idempotency-Key")
+	}
+}
@@ -1,8 +1,10 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -10,89 +12,112 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
-	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
-	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/rabbit"
 	redisadapter "github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/redis"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/auth"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/config"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
-	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/pricing"
 )
 
 type Handlers struct {
 	cfg          *config.Config
 	repo         *crdb.Repository
 	redis        *redisadapter.Cache
-	idemp        *idempotency.Idempotency
 	mongoCatalog *mongo.CatalogRepository
-	rabbitPub    *rabbit.Publisher
+	audit        *mongo.AuditLogger
+	policy       *Policy
+	hub          *AvailabilityHub
 }
 
-func NewHandlers(cfg *config.Config, repo *crdb.Repository, redis *redisadapter.Cache, idemp *idempotency.Idempotency, mongoCatalog *mongo.CatalogRepository, rabbitPub *rabbit.Publisher) *Handlers {
+func NewHandlers(cfg *config.Config, repo *crdb.Repository, redis *redisadapter.Cache, mongoCatalog *mongo.CatalogRepository, audit *mongo.AuditLogger, hub *AvailabilityHub) *Handlers {
 	return &Handlers{
 		cfg:          cfg,
 		repo:         repo,
 		redis:        redis,
-		idemp:        idemp,
 		mongoCatalog: mongoCatalog,
-		rabbitPub:    rabbitPub,
+		audit:        audit,
+		policy:       NewPolicy(audit),
+		hub:          hub,
 	}
 }
 
 func (h *Handlers) CreateHold(w http.ResponseWriter, r *http.Request) {
-	key := r.Header.Get("Idempotency-Key")
-	existing, err := h.idemp.Get(r.Context(), key)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if existing != nil {
-		w.WriteHeader(existing.Status)
-		w.Write(existing.Result)
+	userID, ok := callerID(r)
+	if !ok {
+		writeProblem(w, r, http.StatusUnauthorized, codeUnauthenticated, "unauthenticated")
 		return
 	}
 
 	var req struct {
-		EventID uuid.UUID `json:"event_id"`
-		Seats   []string  `json:"seats"`
-		UserID  uuid.UUID `json:"user_id"`
+		EventID uuid.UUID     `json:"event_id"`
+		Seats   []string      `json:"seats"`
+		Pools   []poolRequest `json:"pools"`
+		UserID  uuid.UUID     `json:"user_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if req.UserID != uuid.Nil && req.UserID != userID {
+		if !h.policy.Allow(r, auth.PermHoldsCreateAny) {
+			writeProblem(w, r, http.StatusForbidden, codeForbidden, "cannot hold seats for another user")
+			return
+		}
+		userID = req.UserID
+	}
+	pools := poolQuantities(req.Pools)
+	if err := domain.ValidateHoldRequest(req.Seats, pools); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
 		return
 	}
 
-	_, err = h.mongoCatalog.GetEvent(r.Context(), req.EventID)
+	event, err := h.mongoCatalog.GetEvent(r.Context(), req.EventID)
 	if err != nil {
-		http.Error(w, "event not found", http.StatusNotFound)
+		writeProblem(w, r, http.StatusNotFound, codeEventNotFound, "event not found")
+		return
+	}
+	if !event.Status.OnSale() {
+		writeProblem(w, r, http.StatusConflict, codeEventNotOnSale, "event is "+strings.ToLower(string(event.Status)))
 		return
 	}
 
-	hold := domain.NewHold(req.EventID, req.Seats, req.UserID, h.cfg.HoldTTL)
+	hold := domain.NewHold(req.EventID, req.Seats, userID, h.cfg.HoldTTL)
+	hold.Pools = pools
 
-	err = h.repo.WithTx(r.Context(), func(tx pgx.Tx) error {
-		for _, seat := range hold.Seats {
-			ok, err := h.redis.SetHoldLock(r.Context(), hold.EventID.String(), seat, hold.UserID.String(), h.cfg.HoldTTL)
-			if err != nil {
-				return err
-			}
-			if !ok {
-				return domain.ErrConflict
-			}
-		}
-		return h.repo.CreateHold(r.Context(), tx, hold)
-	})
+	setClaimLocation(r.Context(), "/v1/holds/"+hold.ID.String())
+	err = h.placeHold(r.Context(), hold)
 	if errors.Is(err, domain.ErrSerializationFailure) {
-		http.Error(w, "conflict, try again", http.StatusConflict)
+		writeProblem(w, r, http.StatusConflict, codeRetryConflict, "conflict, try again")
+		return
+	}
+	var unavailable *domain.SeatsUnavailableError
+	if errors.As(err, &unavailable) {
+		writeSeatsUnavailable(w, r, unavailable)
+		return
+	}
+	var notForSale *domain.SeatsNotForSaleError
+	if errors.As(err, &notForSale) {
+		writeSeatsNotForSale(w, r, notForSale)
+		return
+	}
+	var poolsUnavailable *domain.PoolsUnavailableError
+	if errors.As(err, &poolsUnavailable) {
+		writePoolsUnavailable(w, r, poolsUnavailable)
+		return
+	}
+	var poolsNotForSale *domain.PoolsNotForSaleError
+	if errors.As(err, &poolsNotForSale) {
+		writePoolsNotForSale(w, r, poolsNotForSale)
 		return
 	}
 	if errors.Is(err, domain.ErrConflict) {
-		http.Error(w, "seats already held", http.StatusConflict)
+		writeProblem(w, r, http.StatusConflict, codeSeatsUnavailable, "seats already held")
 		return
 	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
 		return
 	}
 
@@ -104,41 +129,351 @@ func (h *Handlers) CreateHold(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	w.Write(data)
+}
 
-	h.idemp.Set(r.Context(), key, idempotency.Response{Status: http.StatusCreated, Result: data})
+// placeHold stores hold with all its seats and pool admissions or fails
+// with a SeatsUnavailableError or PoolsUnavailableError. Seat locks are taken before the transaction because
+// WithTx may run its body more than once; they are dropped again if the hold
+// is not stored.
+func (h *Handlers) placeHold(ctx context.Context, hold domain.Hold) error {
+	if err := h.lockSeats(ctx, hold); err != nil {
+		return err
+	}
+	err := h.repo.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := h.repo.CreateHold(ctx, tx, hold); err != nil {
+			return err
+		}
+		return h.repo.InsertOutbox(ctx, tx, crdb.HoldOutboxRecord(hold, "hold.created"))
+	})
+	if err != nil {
+		h.unlockSeats(ctx, hold)
+	}
+	return err
 }
 
-func (h *Handlers) CreateOrder(w http.ResponseWriter, r *http.Request) {
-	key := r.Header.Get("Idempotency-Key")
-	existing, err := h.idemp.Get(r.Context(), key)
+// lockSeats takes the Redis lock on every seat of hold or on none of them,
+// failing with a SeatsUnavailableError.
+func (h *Handlers) lockSeats(ctx context.Context, hold domain.Hold) error {
+	return h.redis.LockSeats(ctx, hold.EventID.String(), hold.Seats, hold.ID.String(), h.cfg.HoldTTL)
+}
+
+func (h *Handlers) unlockSeats(ctx context.Context, hold domain.Hold) {
+	h.redis.ReleaseHoldLocks(ctx, hold.EventID.String(), hold.Seats, hold.ID.String())
+}
+
+func (h *Handlers) GetHold(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		writeProblem(w, r, http.StatusUnauthorized, codeUnauthenticated, "unauthenticated")
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
+		return
+	}
+
+	hold, err := h.repo.GetHold(r.Context(), id)
+	if err == nil && hold.UserID != userID && !canAny(r, auth.PermHoldsReadAny) {
+		err = domain.ErrNotFound
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if errors.Is(err, domain.ErrNotFound) {
+			writeProblem(w, r, http.StatusNotFound, codeHoldNotFound, "hold not found")
+			return
+		}
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holdResponse(*hold))
+}
+
+// errHoldLockLost means a seat lock of an active hold lapsed and another
+// hold has taken it since, so the hold is released instead of extended.
+var errHoldLockLost = errors.New("hold lock lost")
+
+func (h *Handlers) ExtendHold(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		writeProblem(w, r, http.StatusUnauthorized, codeUnauthenticated, "unauthenticated")
 		return
 	}
-	if existing != nil {
-		w.WriteHeader(existing.Status)
-		w.Write(existing.Result)
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
 		return
 	}
 
 	var req struct {
-		EventID       uuid.UUID `json:"event_id"`
-		Seats         []string  `json:"seats"`
-		UserID        uuid.UUID `json:"user_id"`
-		PaymentMethod string    `json:"payment_method"`
+		ExtendBySeconds int `json:"extend_by_seconds"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
 		return
 	}
 
-	order := domain.NewOrder(req.EventID, req.Seats, req.UserID, req.PaymentMethod)
-
+	var hold *domain.Hold
+	now := time.Now()
 	err = h.repo.WithTx(r.Context(), func(tx pgx.Tx) error {
+		var err error
+		hold, err = h.repo.GetActiveHold(r.Context(), tx, id)
+		if err != nil {
+			return err
+		}
+		if hold.UserID != userID {
+			return domain.ErrForbidden
+		}
+		expiresAt, err := hold.Extend(time.Duration(req.ExtendBySeconds)*time.Second, h.cfg.HoldMaxTTL, now)
+		if err != nil {
+			return err
+		}
+		if err := h.repo.ExtendHold(r.Context(), tx, hold.ID, expiresAt); err != nil {
+			return err
+		}
+		hold.ExpiresAt = expiresAt
+		return h.repo.InsertOutbox(r.Context(), tx, crdb.HoldOutboxRecord(*hold, "hold.extended"))
+	})
+	if err == nil {
+		err = h.extendSeatLocks(r.Context(), *hold, hold.ExpiresAt.Sub(now))
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			writeProblem(w, r, http.StatusNotFound, codeHoldNotFound, "hold not found")
+		case errors.Is(err, domain.ErrForbidden):
+			writeProblem(w, r, http.StatusForbidden, codeForbidden, "hold belongs to another user")
+		case errors.Is(err, domain.ErrInvalidInput):
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "extend_by_seconds must be positive")
+		case errors.Is(err, domain.ErrHoldExpired):
+			writeProblem(w, r, http.StatusGone, codeHoldExpired, "hold expired")
+		case errors.Is(err, errHoldLockLost):
+			writeProblem(w, r, http.StatusConflict, codeHoldLockLost, "a seat of the hold was taken by another hold; the hold was released")
+		case errors.Is(err, domain.ErrConflict):
+			writeProblem(w, r, http.StatusConflict, codeHoldAtMaxTTL, "hold cannot be extended further")
+		case errors.Is(err, domain.ErrSerializationFailure):
+			writeProblem(w, r, http.StatusConflict, codeRetryConflict, "conflict, try again")
+		default:
+			writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holdResponse(*hold))
+}
+
+// extendSeatLocks extends the seat locks of a hold whose extension is
+// committed. Redis is only touched after the commit because WithTx may run
+// its body more than once. If another hold has taken a seat in the meantime
+// the extended hold cannot keep it, so it is released and errHoldLockLost
+// returned.
+func (h *Handlers) extendSeatLocks(ctx context.Context, hold domain.Hold, ttl time.Duration) error {
+	for _, seat := range hold.Seats {
+		ok, err := h.redis.ExtendHoldLock(ctx, hold.EventID.String(), seat, hold.ID.String(), ttl)
+		if err != nil {
+			// The row is already extended; a lock we fail to extend here
+			// simply runs out its TTL and is taken again on the next extension.
+			continue
+		}
+		if !ok {
+			if _, err := h.releaseHold(ctx, hold.ID, hold.UserID, func() bool { return false }); err != nil && !errors.Is(err, domain.ErrNotFound) {
+				return err
+			}
+			return errHoldLockLost
+		}
+	}
+	return nil
+}
+
+func (h *Handlers) ReleaseHold(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		writeProblem(w, r, http.StatusUnauthorized, codeUnauthenticated, "unauthenticated")
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
+		return
+	}
+
+	_, err = h.releaseHold(r.Context(), id, userID, func() bool {
+		return h.policy.Allow(r, auth.PermHoldsForceRelease)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			writeProblem(w, r, http.StatusNotFound, codeHoldNotFound, "hold not found")
+		case errors.Is(err, domain.ErrForbidden):
+			writeProblem(w, r, http.StatusForbidden, codeForbidden, "hold belongs to another user")
+		case errors.Is(err, domain.ErrSerializationFailure):
+			writeProblem(w, r, http.StatusConflict, codeRetryConflict, "conflict, try again")
+		default:
+			writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// releaseHold releases an active hold on behalf of actorID. mayForce is only
+// consulted when the hold belongs to someone else; such releases are audited.
+func (h *Handlers) releaseHold(ctx context.Context, holdID, actorID uuid.UUID, mayForce func() bool) (*domain.Hold, error) {
+	var hold *domain.Hold
+	err := h.repo.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		hold, err = h.repo.GetActiveHold(ctx, tx, holdID)
+		if err != nil {
+			return err
+		}
+		if hold.UserID != actorID && !mayForce() {
+			return domain.ErrForbidden
+		}
+		if err := h.repo.ReleaseHold(ctx, tx, hold.ID); err != nil {
+			return err
+		}
+		hold.Status = "RELEASED"
+		return h.repo.InsertOutbox(ctx, tx, crdb.HoldOutboxRecord(*hold, "hold.released"))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The row is already released; a lock we fail to drop here simply runs out its TTL.
+	h.unlockSeats(ctx, *hold)
+	if hold.UserID != actorID && h.audit != nil {
+		h.audit.LogEvent(ctx, "hold.force_released", actorID, map[string]interface{}{
+			"hold_id":  hold.ID,
+			"owner_id": hold.UserID,
+			"event_id": hold.EventID,
+			"seats":    hold.Seats,
+			"pools":    poolsJSON(hold.Pools),
+		})
+	}
+	return hold, nil
+}
+
+func callerID(r *http.Request) (uuid.UUID, bool) {
+	identity, ok := auth.IdentityFrom(r.Context())
+	return identity.Subject, ok
+}
+
+// canAny is a silent permission check for reading other users' resources;
+// callers without it get a 404, so there is nothing to audit.
+func canAny(r *http.Request, perm auth.Permission) bool {
+	identity, _ := auth.IdentityFrom(r.Context())
+	return identity.Can(perm)
+}
+
+func holdResponse(hold domain.Hold) map[string]interface{} {
+	resp := map[string]interface{}{
+		"hold_id":    hold.ID,
+		"event_id":   hold.EventID,
+		"seats":      hold.Seats,
+		"user_id":    hold.UserID,
+		"status":     hold.Status,
+		"expires_at": hold.ExpiresAt.Format(time.RFC3339),
+	}
+	if len(hold.Pools) > 0 {
+		resp["pools"] = poolsJSON(hold.Pools)
+	}
+	return resp
+}
+
+// poolRequest asks for a number of admissions to a general admission pool.
+type poolRequest struct {
+	Pool     string `json:"pool"`
+	Quantity int    `json:"quantity"`
+}
+
+func poolQuantities(reqs []poolRequest) []domain.PoolQuantity {
+	if len(reqs) == 0 {
+		return nil
+	}
+	pools := make([]domain.PoolQuantity, len(reqs))
+	for i, req := range reqs {
+		pools[i] = domain.PoolQuantity{Pool: req.Pool, Quantity: req.Quantity}
+	}
+	return pools
+}
+
+func poolsJSON(pools []domain.PoolQuantity) []poolRequest {
+	out := make([]poolRequest, len(pools))
+	for i, p := range pools {
+		out[i] = poolRequest{Pool: p.Pool, Quantity: p.Quantity}
+	}
+	return out
+}
+
+func (h *Handlers) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		writeProblem(w, r, http.StatusUnauthorized, codeUnauthenticated, "unauthenticated")
+		return
+	}
+
+	var req struct {
+		HoldID        uuid.UUID `json:"hold_id"`
+		Currency      string    `json:"currency"`
+		PaymentMethod string    `json:"payment_method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	var order domain.Order
+	var hold *domain.Hold
+	err := h.repo.WithTx(r.Context(), func(tx pgx.Tx) error {
+		var err error
+		hold, err = h.repo.GetActiveHold(r.Context(), tx, req.HoldID)
+		if err != nil {
+			return err
+		}
+		if err := hold.CanConvert(userID, time.Now()); err != nil {
+			return err
+		}
+		event, err := h.mongoCatalog.GetEvent(r.Context(), hold.EventID)
+		if err != nil {
+			return err
+		}
+		if !event.Status.OnSale() {
+			return domain.ErrNotOnSale
+		}
+		currency := req.Currency
+		if currency == "" {
+			currency = event.Currency
+		}
+		if !domain.ValidCurrency(currency) {
+			return fmt.Errorf("%w: currency %q", domain.ErrInvalidInput, currency)
+		}
+		items, err := priceHold(event, *hold, currency)
+		if err != nil {
+			return err
+		}
+		order, err = domain.NewOrder(*hold, items, currency, req.PaymentMethod)
+		if err != nil {
+			return err
+		}
+		setClaimLocation(r.Context(), "/v1/orders/"+order.ID.String())
 		if err := h.repo.CreateOrder(r.Context(), tx, order); err != nil {
 			return err
 		}
-		payload, _ := json.Marshal(map[string]interface{}{"order_id": order.ID})
+		payload, _ := json.Marshal(map[string]interface{}{
+			"order_id":       order.ID,
+			"hold_id":        order.HoldID,
+			"event_id":       hold.EventID,
+			"seats":          hold.Seats,
+			"pools":          poolsJSON(hold.Pools),
+			"total":          moneyJSON(order.TotalAmount),
+			"payment_method": req.PaymentMethod,
+		})
 		outboxRec := crdb.OutboxRecord{
 			ID:            uuid.New(),
 			AggregateType: "order",
@@ -147,17 +482,40 @@ func (h *Handlers) CreateOrder(w http.ResponseWriter, r *http.Request) {
 			Payload:       payload,
 			DedupeKey:     uuid.New().String(),
 		}
-		return h.repo.InsertOutbox(r.Context(), tx, outboxRec)
+		if err := h.repo.InsertOutbox(r.Context(), tx, outboxRec); err != nil {
+			return err
+		}
+		// order.created doubles as the payment request picked up by billing.
+		if _, err := h.repo.TransitionOrder(r.Context(), tx, order.ID, domain.OrderAwaitingPayment, "payment requested"); err != nil {
+			return err
+		}
+		order.Status = domain.OrderAwaitingPayment
+		return nil
 	})
 	if err != nil {
-		if errors.Is(err, domain.ErrConflict) {
-			http.Error(w, "conflict", http.StatusConflict)
-			return
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			writeProblem(w, r, http.StatusNotFound, codeHoldNotFound, "hold not found")
+		case errors.Is(err, domain.ErrForbidden):
+			writeProblem(w, r, http.StatusForbidden, codeForbidden, "hold belongs to another user")
+		case errors.Is(err, domain.ErrHoldExpired):
+			writeProblem(w, r, http.StatusGone, codeHoldExpired, "hold expired")
+		case errors.Is(err, domain.ErrNotOnSale):
+			writeProblem(w, r, http.StatusConflict, codeEventNotOnSale, "event is not on sale")
+		case errors.Is(err, domain.ErrInvalidInput):
+			writeProblem(w, r, http.StatusUnprocessableEntity, codeUnprocessable, err.Error())
+		case errors.Is(err, domain.ErrConflict), errors.Is(err, domain.ErrSerializationFailure):
+			writeProblem(w, r, http.StatusConflict, codeRetryConflict, "conflict")
+		default:
+			h.unlockOrderedHold(r.Context(), order.ID, hold)
+			writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// The hold is consumed by the order; a lock we fail to drop here simply runs out its TTL.
+	h.unlockSeats(r.Context(), *hold)
+
 	resp := map[string]interface{}{
 		"order_id": order.ID,
 		"status":   order.Status,
@@ -166,37 +524,123 @@ func (h *Handlers) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	w.Write(data)
+}
 
-	h.idemp.Set(r.Context(), key, idempotency.Response{Status: http.StatusAccepted, Result: data})
+// unlockOrderedHold drops the seat locks of hold if the order orderID was
+// stored after all, as when the commit went through but was reported as
+// failed. Any other failure rolls back and leaves the hold and its locks.
+func (h *Handlers) unlockOrderedHold(ctx context.Context, orderID uuid.UUID, hold *domain.Hold) {
+	if hold == nil || orderID == uuid.Nil {
+		return
+	}
+	order, err := h.repo.GetOrder(ctx, orderID)
+	if err != nil || order.HoldID != hold.ID {
+		return
+	}
+	h.unlockSeats(ctx, *hold)
 }
 
 func (h *Handlers) GetOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		writeProblem(w, r, http.StatusUnauthorized, codeUnauthenticated, "unauthenticated")
+		return
+	}
+
 	idStr := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		http.Error(w, "invalid id", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
 		return
 	}
 
 	order, err := h.repo.GetOrder(r.Context(), id)
+	if err == nil && order.UserID != userID && !canAny(r, auth.PermOrdersReadAny) {
+		err = domain.ErrNotFound
+	}
 	if err != nil {
 		if errors.Is(err, domain.ErrNotFound) {
-			http.Error(w, "order not found", http.StatusNotFound)
+			writeProblem(w, r, http.StatusNotFound, codeOrderNotFound, "order not found")
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
 		return
 	}
 
+	items := make([]map[string]interface{}, len(order.Items))
+	for i, item := range order.Items {
+		breakdown := make([]map[string]interface{}, len(item.Breakdown))
+		for j, c := range item.Breakdown {
+			breakdown[j] = map[string]interface{}{
+				"kind":   c.Kind,
+				"name":   c.Name,
+				"amount": moneyJSON(c.Amount),
+			}
+		}
+		items[i] = map[string]interface{}{
+			"event_id":  item.EventID,
+			"quantity":  item.Quantity,
+			"price":     moneyJSON(item.Price),
+			"breakdown": breakdown,
+		}
+		if item.Pool != "" {
+			items[i]["pool"] = item.Pool
+		} else {
+			items[i]["seat_no"] = item.SeatNo
+		}
+	}
 	resp := map[string]interface{}{
-		"status": order.Status,
-		"items":  order.Items,
-		"total":  order.TotalAmount,
+		"order_id": order.ID,
+		"status":   order.Status,
+		"items":    items,
+		"total":    moneyJSON(order.TotalAmount),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+// priceHold prices the seats and pool admissions of hold from the catalog
+// entry of its event; pool items are priced per admission.
+func priceHold(event *mongo.EventDoc, hold domain.Hold, currency string) ([]domain.OrderItem, error) {
+	seats := make([]pricing.Seat, 0, len(event.Seats))
+	for _, s := range event.Seats {
+		if amount, ok := s.Prices[currency]; ok {
+			seats = append(seats, pricing.Seat{Number: s.Number, Section: s.Section, Tier: s.Tier, Price: domain.NewMoney(amount, currency)})
+		}
+	}
+	rules := pricing.Rules{Currency: currency, TaxName: event.Pricing.TaxName, TaxRateBP: event.Pricing.TaxRateBP}
+	for _, t := range event.Pricing.Tiers {
+		rules.Tiers = append(rules.Tiers, pricing.TierRule{Name: t.Name, Section: t.Section, Tier: t.Tier, MultiplierBP: t.MultiplierBP, Surcharge: t.Surcharge[currency]})
+	}
+	for _, f := range event.Pricing.Fees {
+		rules.Fees = append(rules.Fees, pricing.Fee{Name: f.Name, Flat: f.Flat[currency], PercentBP: f.PercentBP})
+	}
+	engine := pricing.NewEngine(rules)
+	items, err := engine.Price(hold.EventID, seats, hold.Seats)
+	if err != nil || len(hold.Pools) == 0 {
+		return items, err
+	}
+
+	pools := make([]pricing.Pool, 0, len(event.Pools))
+	for _, p := range event.Pools {
+		if amount, ok := p.Prices[currency]; ok {
+			pools = append(pools, pricing.Pool{ID: p.ID, Tier: p.Tier, Price: domain.NewMoney(amount, currency)})
+		}
+	}
+	poolItems, err := engine.PricePools(hold.EventID, pools, hold.Pools)
+	if err != nil {
+		return nil, err
+	}
+	return append(items, poolItems...), nil
+}
+
+func moneyJSON(m domain.Money) map[string]interface{} {
+	return map[string]interface{}{
+		"amount":   m.Decimal(),
+		"currency": m.Currency,
+	}
+}
+
 func (h *Handlers) PaymentCallback(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		OrderID       uuid.UUID `json:"order_id"`
@@ -204,28 +648,51 @@ func (h *Handlers) PaymentCallback(w http.ResponseWriter, r *http.Request) {
 		TransactionID string    `json:"transaction_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
 		return
 	}
 
-	newStatus := "FAILED"
-	if req.Status == "SUCCEEDED" {
-		newStatus = "CONFIRMED"
+	if req.TransactionID == "" {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "missing transaction_id")
+		return
 	}
-	err := h.repo.UpdateOrderStatus(r.Context(), req.OrderID, newStatus)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+	var newStatus domain.OrderStatus
+	switch req.Status {
+	case "SUCCEEDED":
+		newStatus = domain.OrderConfirmed
+	case "FAILED":
+		newStatus = domain.OrderFailed
+	case "REFUNDED":
+		newStatus = domain.OrderRefunded
+	default:
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "unknown payment status")
 		return
 	}
 
-	eventType := "order." + strings.ToLower(newStatus)
-	payload, _ := json.Marshal(map[string]interface{}{"order_id": req.OrderID, "status": newStatus})
-	msg := amqp.Publishing{
-		MessageId:   uuid.New().String(),
-		ContentType: "application/json",
-		Body:        payload,
+	err := h.repo.WithTx(r.Context(), func(tx pgx.Tx) error {
+		// A refund reuses the transaction id of the original charge, so the
+		// status is part of the message identity.
+		fresh, err := h.repo.InsertInbox(r.Context(), tx, "payment:"+req.TransactionID+":"+req.Status)
+		if err != nil || !fresh {
+			return err
+		}
+		_, err = h.repo.TransitionOrder(r.Context(), tx, req.OrderID, newStatus, "payment "+strings.ToLower(req.Status)+" "+req.TransactionID)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			writeProblem(w, r, http.StatusNotFound, codeOrderNotFound, "order not found")
+		case errors.Is(err, domain.ErrConflict):
+			writeProblem(w, r, http.StatusConflict, codeTransitionNotAllowed, err.Error())
+		case errors.Is(err, domain.ErrSerializationFailure):
+			writeProblem(w, r, http.StatusConflict, codeRetryConflict, "conflict, try again")
+		default:
+			writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		}
+		return
 	}
-	h.rabbitPub.Publish(r.Context(), eventType, msg)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -1,11 +1,25 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/auth"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/config"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/rateLimit"
@@ -29,13 +43,115 @@ func LoggerMiddleware(logger observability.Logger) func(next http.Handler) http.
 	}
 }
 
-func JWTMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
-	})
+func JWTMiddleware(verifier *auth.Verifier) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := auth.BearerToken(r.Header.Get("Authorization"))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				writeProblem(w, r, http.StatusUnauthorized, codeUnauthenticated, err.Error())
+				return
+			}
+			identity, err := verifier.Verify(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeProblem(w, r, http.StatusUnauthorized, codeUnauthenticated, "invalid token")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+		})
+	}
 }
 
-func IdempotencyMiddleware(idemp *idempotency.Idempotency) func(next http.Handler) http.Handler {
+const SignatureHeader = "X-Signature"
+
+var (
+	errMissingSignature = errors.New("missing signature")
+	errStaleSignature   = errors.New("signature timestamp outside tolerance")
+	errBadSignature     = errors.New("signature mismatch")
+)
+
+// PaymentSignatureMiddleware authenticates provider callbacks signed as
+// "t=<unix seconds>,v1=<hex hmac-sha256 of t.body>". Any of secrets may match,
+// which lets the shared secret be rotated without dropping callbacks.
+func PaymentSignatureMiddleware(secrets []string, tolerance time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "failed to read body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			if err := VerifySignature(r.Header.Get(SignatureHeader), body, secrets, tolerance, time.Now()); err != nil {
+				writeProblem(w, r, http.StatusUnauthorized, codeInvalidSignature, err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func SignPayload(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(signatureMAC(secret, ts, body))
+}
+
+func VerifySignature(header string, body []byte, secrets []string, tolerance time.Duration, now time.Time) error {
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			if sig, err := hex.DecodeString(v); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	if ts == "" || len(sigs) == 0 {
+		return errMissingSignature
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errMissingSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return errStaleSignature
+	}
+
+	for _, secret := range secrets {
+		expected := signatureMAC(secret, ts, body)
+		for _, sig := range sigs {
+			if hmac.Equal(sig, expected) {
+				return nil
+			}
+		}
+	}
+	return errBadSignature
+}
+
+func signatureMAC(secret, ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// IdempotencyMiddleware makes every POST in its group safe to retry with the
+// same Idempotency-Key. The first request claims the key and its response
+// (status, headers added by the handler and body) is stored for the route's
+// TTL; later requests get that response replayed byte-for-byte. Server
+// errors and conflicts are not stored, so those can be retried. The claim is
+// passed on in the request context so crdb.Repository.WithTx can commit it
+// with the handler's write. It must run after routing and JWTMiddleware,
+// since the fingerprint includes the caller.
+func IdempotencyMiddleware(idemp *idempotency.Idempotency, ttls map[string]time.Duration) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.Method != "POST" {
@@ -44,25 +160,178 @@ func IdempotencyMiddleware(idemp *idempotency.Idempotency) func(next http.Handle
 			}
 			key := r.Header.Get("Idempotency-Key")
 			if key == "" {
-				http.Error(w, "missing Idempotency-Key", http.StatusBadRequest)
+				writeProblem(w, r, http.StatusBadRequest, codeIdempotencyKeyMissing, "missing Idempotency-Key")
 				return
 			}
 			if len(key) < 16 {
-				http.Error(w, "invalid Idempotency-Key", http.StatusBadRequest)
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "Idempotency-Key must be at least 16 characters")
 				return
 			}
-			next.ServeHTTP(w, r)
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "failed to read body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			caller := ""
+			if id, ok := auth.IdentityFrom(r.Context()); ok {
+				caller = id.Subject.String()
+			}
+			fingerprint := idempotency.Fingerprint(r.Method, r.URL.Path, caller, body)
+			route := r.Method + " " + chi.RouteContext(r.Context()).RoutePattern()
+			claim, existing, err := idemp.Begin(r.Context(), key, fingerprint, ttls[route])
+			switch {
+			case errors.Is(err, idempotency.ErrInProgress):
+				writeProblem(w, r, http.StatusConflict, codeIdempotencyInProgress, err.Error())
+				return
+			case errors.Is(err, idempotency.ErrFingerprintMismatch):
+				writeProblem(w, r, http.StatusUnprocessableEntity, codeIdempotencyKeyReused, err.Error())
+				return
+			case errors.Is(err, idempotency.ErrAlreadyProcessed):
+				writeAlreadyProcessed(w, r, err)
+				return
+			case err != nil:
+				writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+				return
+			case existing != nil:
+				for name, values := range existing.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.Status)
+				w.Write(existing.Result)
+				return
+			}
+			defer idemp.Release(r.Context(), claim)
+
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, r.WithContext(idempotency.WithClaim(r.Context(), claim)))
+
+			if rec.status >= http.StatusInternalServerError || rec.status == http.StatusConflict {
+				return
+			}
+			idemp.Complete(r.Context(), claim, idempotency.Response{
+				Status: rec.status,
+				Header: rec.header,
+				Result: rec.body.Bytes(),
+			})
 		})
 	}
 }
 
-func RateLimitMiddleware(rl *rateLimit.RateLimiter) func(next http.Handler) http.Handler {
+// writeAlreadyProcessed answers a retry whose original request committed
+// but lost its response, pointing at the created resource when known.
+func writeAlreadyProcessed(w http.ResponseWriter, r *http.Request, err error) {
+	var processed *idempotency.AlreadyProcessedError
+	if errors.As(err, &processed) && processed.Location != "" {
+		w.Header().Set("Location", processed.Location)
+	}
+	writeProblem(w, r, http.StatusConflict, codeIdempotencyProcessed, err.Error())
+}
+
+// setClaimLocation names the resource the request's guarded write creates
+// on its Idempotency-Key claim, if it has one.
+func setClaimLocation(ctx context.Context, location string) {
+	if claim, ok := idempotency.ClaimFrom(ctx); ok {
+		claim.Location = location
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+// Only headers the handler itself adds are kept, so values set by earlier
+// middleware such as rate limits and request ids are not replayed.
+type responseRecorder struct {
+	http.ResponseWriter
+	before http.Header
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, before: w.Header().Clone()}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = status
+	rec.header = http.Header{}
+	for name, values := range rec.Header() {
+		if _, ok := rec.before[name]; !ok {
+			rec.header[name] = slices.Clone(values)
+		}
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// RateLimitMiddleware counts each request against the caller's user bucket
+// and client IP bucket for the matched route. It must run after routing and
+// after JWTMiddleware so the route pattern and identity are known.
+func RateLimitMiddleware(rl *rateLimit.RateLimiter, policies map[string]config.RateLimitPolicy, trustedProxies []netip.Prefix) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID := ""
-			ip := r.RemoteAddr
-			if !rl.Allow(r.Context(), "user:"+userID, 10, time.Minute) || !rl.Allow(r.Context(), "ip:"+ip, 100, time.Minute) {
-				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			route := r.Method + " " + chi.RouteContext(r.Context()).RoutePattern()
+			policy, ok := policies[route]
+			if !ok {
+				route = "default"
+				policy = policies[route]
+			}
+
+			type bucket struct {
+				key   string
+				limit config.RateLimit
+			}
+			var buckets []bucket
+			if id, ok := auth.IdentityFrom(r.Context()); ok && policy.User.Limit > 0 {
+				buckets = append(buckets, bucket{"user:" + id.Subject.String() + ":" + route, policy.User})
+			}
+			if policy.IP.Limit > 0 {
+				buckets = append(buckets, bucket{"ip:" + ClientIP(r, trustedProxies) + ":" + route, policy.IP})
+			}
+
+			var tightest *rateLimit.Result
+			for _, b := range buckets {
+				res, err := rl.Allow(r.Context(), b.key, rateLimit.Limit{
+					Rate:      b.limit.Limit,
+					Period:    b.limit.Period,
+					Algorithm: rateLimit.Algorithm(policy.Algorithm),
+					FailMode:  rateLimit.FailMode(policy.FailMode),
+				})
+				if err != nil {
+					writeProblem(w, r, http.StatusServiceUnavailable, codeUnavailable, "rate limiter unavailable")
+					return
+				}
+				if tightest == nil || !res.Allowed || res.Remaining < tightest.Remaining {
+					tightest = &res
+				}
+				if !res.Allowed {
+					break
+				}
+			}
+			if tightest == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(tightest.ResetAfter))
+			if !tightest.Allowed {
+				observability.RateLimitExceeded.Inc()
+				w.Header().Set("Retry-After", ceilSeconds(tightest.RetryAfter))
+				writeProblem(w, r, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded")
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -70,6 +339,10 @@ func RateLimitMiddleware(rl *rateLimit.RateLimiter) func(next http.Handler) http
 	}
 }
 
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
 func TracingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := otel.GetTextMapPropagator().Extract(r.Context(), otelhttp.HeaderCarrier(r.Header))
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
+)
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"order_id":"0b6c3a36-8f4e-4b43-9d38-43c6e1f0c0de","status":"SUCCEEDED","transaction_id":"tx123"}`)
+	now := time.Unix(1_760_000_000, 0)
+	secrets := []string{"new-secret", "old-secret"}
+
+	tests := []struct {
+		name   string
+		header string
+		body   []byte
+		want   error
+	}{
+		{name: "current secret", header: SignPayload("new-secret", now, body), body: body},
+		{name: "rotated out secret still accepted", header: SignPayload("old-secret", now, body), body: body},
+		{name: "unknown secret", header: SignPayload("other", now, body), body: body, want: errBadSignature},
+		{name: "tampered body", header: SignPayload("new-secret", now, body), body: []byte(`{}`), want: errBadSignature},
+		{name: "too old", header: SignPayload("new-secret", now.Add(-6*time.Minute), body), body: body, want: errStaleSignature},
+		{name: "from the future", header: SignPayload("new-secret", now.Add(6*time.Minute), body), body: body, want: errStaleSignature},
+		{name: "missing", header: "", body: body, want: errMissingSignature},
+	}
+	for _, tt := range tests {
+		if err := VerifySignature(tt.header, tt.body, secrets, 5*time.Minute, now); err != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{name: "direct client, port stripped", remoteAddr: "203.0.113.7:51234", want: "203.0.113.7"},
+		{name: "untrusted peer cannot spoof", remoteAddr: "203.0.113.7:51234", forwarded: "198.51.100.1", want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:80", forwarded: "198.51.100.1", want: "198.51.100.1"},
+		{name: "spoofed left entries ignored", remoteAddr: "10.0.0.2:80", forwarded: "1.1.1.1, 198.51.100.1, 10.0.0.3", want: "198.51.100.1"},
+		{name: "ipv6 with port", remoteAddr: "[2001:db8::1]:443", want: "2001:db8::1"},
+		{name: "garbage header falls back to last proxy", remoteAddr: "10.0.0.2:80", forwarded: "nonsense", want: "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := ClientIP(r, trusted); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestResponseRecorder(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("RateLimit-Remaining", "4")
+
+	rec := newResponseRecorder(w)
+	rec.Header().Set("Content-Type", "application/json")
+	rec.Header().Set("Location", "/v1/orders/1")
+	rec.WriteHeader(http.StatusAccepted)
+	rec.WriteHeader(http.StatusInternalServerError)
+	rec.Write([]byte(`{"status":`))
+	rec.Write([]byte(`"PENDING"}`))
+
+	if rec.status != http.StatusAccepted || w.Code != http.StatusAccepted {
+		t.Errorf("expected the first status to win, got %d recorded and %d sent", rec.status, w.Code)
+	}
+	if got := rec.body.String(); got != `{"status":"PENDING"}` || w.Body.String() != got {
+		t.Errorf("expected body to be recorded and passed through, got %q", got)
+	}
+	if len(rec.header) != 2 || rec.header.Get("Content-Type") != "application/json" || rec.header.Get("Location") == "" {
+		t.Errorf("expected only handler headers to be recorded, got %v", rec.header)
+	}
+}
+
+func TestWriteAlreadyProcessed(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeAlreadyProcessed(w, httptest.NewRequest("POST", "/v1/orders", nil), &idempotency.AlreadyProcessedError{Location: "/v1/orders/1"})
+
+	if w.Code != http.StatusConflict || w.Header().Get("Location") != "/v1/orders/1" {
+		t.Fatalf("expected 409 pointing at the order, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != codeIdempotencyProcessed {
+		t.Errorf("expected code %s, got %s", codeIdempotencyProcessed, p.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/auth"
+)
+
+// Policy decides which authenticated callers may use which routes and writes
+// every denial to the audit log.
+type Policy struct {
+	audit *mongo.AuditLogger
+}
+
+func NewPolicy(audit *mongo.AuditLogger) *Policy {
+	return &Policy{audit: audit}
+}
+
+// Require rejects the request with 403 unless the caller holds perm.
+func (p *Policy) Require(perm auth.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !p.Allow(r, perm) {
+				writeProblem(w, r, http.StatusForbidden, codeForbidden, "missing permission "+string(perm))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Allow checks perm for the caller of r and audits a denial.
+func (p *Policy) Allow(r *http.Request, perm auth.Permission) bool {
+	identity, ok := auth.IdentityFrom(r.Context())
+	if ok && identity.Can(perm) {
+		return true
+	}
+	if p.audit != nil {
+		route := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		p.audit.LogEvent(r.Context(), "authz.denied", identity.Subject, map[string]interface{}{
+			"permission": string(perm),
+			"method":     r.Method,
+			"route":      route,
+			"path":       r.URL.Path,
+			"roles":      identity.Roles,
+		})
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem codes are the stable, machine-readable part of an error response;
+// clients should switch on code rather than on detail text.
+const (
+	codeInvalidRequest        = "invalid_request"
+	codeNotFound              = "not_found"
+	codeMethodNotAllowed      = "method_not_allowed"
+	codeUnauthenticated       = "unauthenticated"
+	codeForbidden             = "forbidden"
+	codeEventNotFound         = "event_not_found"
+	codeEventNotOnSale        = "event_not_on_sale"
+	codeVenueNotFound         = "venue_not_found"
+	codeLayoutNotFound        = "layout_not_found"
+	codeHoldNotFound          = "hold_not_found"
+	codeOrderNotFound         = "order_not_found"
+	codeSeatsUnavailable      = "seats_unavailable"
+	codeSeatsNotForSale       = "seats_not_for_sale"
+	codePoolsUnavailable      = "pools_unavailable"
+	codePoolsNotForSale       = "pools_not_for_sale"
+	codeHoldExpired           = "hold_expired"
+	codeHoldAtMaxTTL          = "hold_at_max_ttl"
+	codeHoldLockLost          = "hold_lock_lost"
+	codeTransitionNotAllowed  = "transition_not_allowed"
+	codeRetryConflict         = "retry_conflict"
+	codeUnprocessable         = "unprocessable"
+	codeIdempotencyKeyMissing = "idempotency_key_missing"
+	codeIdempotencyInProgress = "idempotency_in_progress"
+	codeIdempotencyKeyReused  = "idempotency_key_reused"
+	codeIdempotencyProcessed  = "idempotency_already_processed"
+	codeInvalidSignature      = "invalid_signature"
+	codeRateLimited           = "rate_limited"
+	codeUnavailable           = "unavailable"
+	codeInternal              = "internal"
+)
+
+// Problem is an RFC 7807 error body with a code and, for seat and pool
+// conflicts, the seats or pools that were taken.
+type Problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Code     string         `json:"code"`
+	Seats    []SeatConflict `json:"seats,omitempty"`
+	Pools    []PoolConflict `json:"pools,omitempty"`
+}
+
+type SeatConflict struct {
+	Seat string `json:"seat"`
+	// HeldUntil is when the current hold lapses; the seat may free up then
+	// unless the hold is extended or turned into an order.
+	HeldUntil *time.Time `json:"held_until,omitempty"`
+}
+
+type PoolConflict struct {
+	Pool string `json:"pool"`
+	// Remaining is how many admissions the pool still has, if known.
+	Remaining *int `json:"remaining,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	writeProblemBody(w, r, Problem{Status: status, Code: code, Detail: detail})
+}
+
+func writeProblemBody(w http.ResponseWriter, r *http.Request, p Problem) {
+	p.Type = "/problems/" + p.Code
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func writeSeatsUnavailable(w http.ResponseWriter, r *http.Request, err *domain.SeatsUnavailableError) {
+	p := Problem{Status: http.StatusConflict, Code: codeSeatsUnavailable, Detail: err.Error(), Seats: seatConflicts(err)}
+	writeProblemBody(w, r, p)
+}
+
+func writeSeatsNotForSale(w http.ResponseWriter, r *http.Request, err *domain.SeatsNotForSaleError) {
+	p := Problem{Status: http.StatusUnprocessableEntity, Code: codeSeatsNotForSale, Detail: err.Error()}
+	for _, seat := range err.Seats {
+		p.Seats = append(p.Seats, SeatConflict{Seat: seat})
+	}
+	writeProblemBody(w, r, p)
+}
+
+func seatConflicts(err *domain.SeatsUnavailableError) []SeatConflict {
+	var conflicts []SeatConflict
+	for _, seat := range err.Seats {
+		conflict := SeatConflict{Seat: seat}
+		if until, ok := err.HeldUntil[seat]; ok {
+			until := until.UTC()
+			conflict.HeldUntil = &until
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
+
+func writePoolsUnavailable(w http.ResponseWriter, r *http.Request, err *domain.PoolsUnavailableError) {
+	p := Problem{Status: http.StatusConflict, Code: codePoolsUnavailable, Detail: err.Error(), Pools: poolConflicts(err)}
+	writeProblemBody(w, r, p)
+}
+
+func writePoolsNotForSale(w http.ResponseWriter, r *http.Request, err *domain.PoolsNotForSaleError) {
+	p := Problem{Status: http.StatusUnprocessableEntity, Code: codePoolsNotForSale, Detail: err.Error()}
+	for _, pool := range err.Pools {
+		p.Pools = append(p.Pools, PoolConflict{Pool: pool})
+	}
+	writeProblemBody(w, r, p)
+}
+
+func poolConflicts(err *domain.PoolsUnavailableError) []PoolConflict {
+	var conflicts []PoolConflict
+	for _, pool := range err.Pools {
+		conflict := PoolConflict{Pool: pool}
+		if remaining, ok := err.Remaining[pool]; ok {
+			conflict.Remaining = &remaining
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
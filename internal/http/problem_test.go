@@ -0,0 +1,60 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+func TestWriteSeatsUnavailable(t *testing.T) {
+	until := time.Date(2026, 10, 16, 12, 5, 0, 0, time.UTC)
+	err := &domain.SeatsUnavailableError{
+		Seats:     []string{"A1", "A2"},
+		HeldUntil: map[string]time.Time{"A1": until},
+	}
+
+	w := httptest.NewRecorder()
+	writeSeatsUnavailable(w, httptest.NewRequest("POST", "/v1/holds", nil), err)
+
+	if w.Code != http.StatusConflict || w.Header().Get("Content-Type") != problemContentType {
+		t.Fatalf("expected 409 problem+json, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != codeSeatsUnavailable || p.Type != "/problems/seats_unavailable" || p.Title != "Conflict" || p.Status != 409 || p.Instance != "/v1/holds" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+	if len(p.Seats) != 2 || p.Seats[0].Seat != "A1" || !p.Seats[0].HeldUntil.Equal(until) || p.Seats[1].HeldUntil != nil {
+		t.Errorf("expected A1 with its expiry and A2 without, got %+v", p.Seats)
+	}
+}
+
+func TestWritePoolsUnavailable(t *testing.T) {
+	err := &domain.PoolsUnavailableError{
+		Pools:     []string{"standing", "vip"},
+		Remaining: map[string]int{"standing": 3},
+	}
+
+	w := httptest.NewRecorder()
+	writePoolsUnavailable(w, httptest.NewRequest("POST", "/v1/holds", nil), err)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", w.Code)
+	}
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != codePoolsUnavailable || len(p.Seats) != 0 {
+		t.Errorf("unexpected problem %+v", p)
+	}
+	if len(p.Pools) != 2 || p.Pools[0].Pool != "standing" || *p.Pools[0].Remaining != 3 || p.Pools[1].Remaining != nil {
+		t.Errorf("expected standing with 3 left and vip without a count, got %+v", p.Pools)
+	}
+}
@@ -1,29 +1,75 @@
 package http
 
 import (
+	"net/http"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/auth"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/rateLimit"
 )
 
-func SetupRouter(h *Handlers, logger observability.Logger, rl *rateLimit.RateLimiter, idemp *idempotency.Idempotency) *chi.Mux {
+func SetupRouter(h *Handlers, logger observability.Logger, verifier *auth.Verifier, rl *rateLimit.RateLimiter, idemp *idempotency.Idempotency) *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Recoverer)
 	r.Use(RequestIDMiddleware)
 	r.Use(LoggerMiddleware(logger))
 	r.Use(TracingMiddleware)
-	r.Use(JWTMiddleware)
-	r.Use(RateLimitMiddleware(rl))
-	r.Use(IdempotencyMiddleware(idemp))
-
-	r.Post("/v1/holds", h.CreateHold)
-	r.Post("/v1/orders", h.CreateOrder)
-	r.Get("/v1/orders/{id}", h.GetOrder)
-	r.Post("/v1/payments/callback", h.PaymentCallback)
+
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, http.StatusNotFound, codeNotFound, "no such route")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not allowed on this route")
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(JWTMiddleware(verifier))
+		r.Use(RateLimitMiddleware(rl, h.cfg.RateLimits, h.cfg.TrustedProxies))
+		r.Use(IdempotencyMiddleware(idemp, h.cfg.IdempotencyTTLs))
+
+		r.With(h.policy.Require(auth.PermHoldsCreate)).Post("/v1/holds", h.CreateHold)
+		r.With(h.policy.Require(auth.PermHoldsRead)).Get("/v1/holds/{id}", h.GetHold)
+		r.With(h.policy.Require(auth.PermHoldsUpdate)).Patch("/v1/holds/{id}", h.ExtendHold)
+		r.With(h.policy.Require(auth.PermHoldsUpdate)).Delete("/v1/holds/{id}", h.ReleaseHold)
+		r.With(h.policy.Require(auth.PermOrdersCreate)).Post("/v1/orders", h.CreateOrder)
+		r.With(h.policy.Require(auth.PermOrdersRead)).Get("/v1/orders/{id}", h.GetOrder)
+		r.With(h.policy.Require(auth.PermHoldsCreateAny)).Get("/v1/boxoffice/ws", h.BoxOffice(rl))
+
+		manage := r.With(h.policy.Require(auth.PermEventsManage))
+		manage.Post("/v1/admin/events", h.CreateEvent)
+		manage.Get("/v1/admin/events", h.ListEvents)
+		manage.Get("/v1/admin/events/{id}", h.GetEventAdmin)
+		manage.Put("/v1/admin/events/{id}", h.UpdateEvent)
+		manage.Post("/v1/admin/events/{id}/publish", h.TransitionEvent(domain.EventPublished))
+		manage.Post("/v1/admin/events/{id}/unpublish", h.TransitionEvent(domain.EventDraft))
+		manage.Post("/v1/admin/events/{id}/cancel", h.TransitionEvent(domain.EventCancelled))
+		manage.Post("/v1/admin/venues", h.CreateVenue)
+		manage.Get("/v1/admin/venues/{id}", h.GetVenue)
+		manage.Post("/v1/admin/venues/{id}/layouts", h.ImportLayout)
+		manage.Get("/v1/admin/layouts/{id}", h.GetLayout)
+	})
+
+	// Events and seat maps can be browsed without a token, so only the IP
+	// bucket applies to anonymous callers.
+	r.Group(func(r chi.Router) {
+		r.Use(RateLimitMiddleware(rl, h.cfg.RateLimits, h.cfg.TrustedProxies))
+
+		r.Get("/v1/events", h.SearchEvents)
+		r.Get("/v1/events/{id}/availability", h.GetAvailability)
+		r.Get("/v1/events/{id}/availability/stream", h.StreamAvailability)
+	})
+
+	// Payment providers authenticate with a signature and are deduplicated by
+	// transaction id, so they bypass JWT, rate limits and Idempotency-Key.
+	r.With(PaymentSignatureMiddleware(h.cfg.PaymentWebhookSecrets, h.cfg.PaymentWebhookTolerance)).
+		Post("/v1/payments/callback", h.PaymentCallback)
+
 	r.Get("/v1/healthz", h.Healthz)
 	r.Get("/v1/readyz", h.Readyz)
 	r.Get("/metrics", promhttp.Handler().ServeHTTP)
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+type searchResponse struct {
+	Events     []mongo.EventDoc `json:"events"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// SearchEvents is the storefront listing of published events. Pages are
+// linked by an opaque cursor; next_cursor is absent on the last page.
+func (h *Handlers) SearchEvents(w http.ResponseWriter, r *http.Request) {
+	q, err := parseEventQuery(r.URL.Query())
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	// One extra event tells whether there is a next page.
+	limit := q.Limit
+	q.Limit++
+	events, err := h.mongoCatalog.SearchEvents(r.Context(), q)
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	resp := searchResponse{Events: events}
+	if int64(len(events)) > limit {
+		resp.Events = events[:limit]
+		resp.NextCursor = encodeEventCursor(nextEventCursor(q, resp.Events))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseEventQuery reads q, from, to, venue, sort, limit and cursor. A
+// cursor only continues a listing with the same sort.
+func parseEventQuery(values url.Values) (mongo.EventQuery, error) {
+	q := mongo.EventQuery{
+		Text:  values.Get("q"),
+		Venue: values.Get("venue"),
+		Sort:  mongo.EventSort(values.Get("sort")),
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = mongo.SortDate
+		if q.Text != "" {
+			q.Sort = mongo.SortRelevance
+		}
+	case mongo.SortDate, mongo.SortDateDesc, mongo.SortName:
+	case mongo.SortRelevance:
+		if q.Text == "" {
+			return q, fmt.Errorf("%w: sort=relevance needs q", domain.ErrInvalidInput)
+		}
+	default:
+		return q, fmt.Errorf("%w: unknown sort %q", domain.ErrInvalidInput, q.Sort)
+	}
+
+	for name, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if value := values.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return q, fmt.Errorf("%w: %s must be an RFC 3339 time", domain.ErrInvalidInput, name)
+			}
+			*dst = t
+		}
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.To.After(q.From) {
+		return q, fmt.Errorf("%w: to must be after from", domain.ErrInvalidInput)
+	}
+
+	limit, err := queryInt(values.Get("limit"), defaultSearchPageSize)
+	if err != nil || limit < 1 || limit > maxSearchPageSize {
+		return q, fmt.Errorf("%w: limit must be between 1 and %d", domain.ErrInvalidInput, maxSearchPageSize)
+	}
+	q.Limit = int64(limit)
+
+	if value := values.Get("cursor"); value != "" {
+		cursor, err := decodeEventCursor(value)
+		if err != nil || cursor.Sort != q.Sort {
+			return q, fmt.Errorf("%w: invalid cursor", domain.ErrInvalidInput)
+		}
+		q.After = cursor
+	}
+	return q, nil
+}
+
+// nextEventCursor points after the last of page, which is not empty.
+func nextEventCursor(q mongo.EventQuery, page []mongo.EventDoc) mongo.EventCursor {
+	last := page[len(page)-1]
+	cursor := mongo.EventCursor{Sort: q.Sort, ID: last.ID}
+	switch q.Sort {
+	case mongo.SortRelevance:
+		cursor = mongo.EventCursor{Sort: q.Sort, Offset: int64(len(page))}
+		if q.After != nil {
+			cursor.Offset += q.After.Offset
+		}
+	case mongo.SortName:
+		cursor.Name = last.Name
+	default:
+		cursor.Date = last.Date
+	}
+	return cursor
+}
+
+func encodeEventCursor(cursor mongo.EventCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeEventCursor(value string) (*mongo.EventCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor mongo.EventCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+func TestParseEventQuery(t *testing.T) {
+	q, err := parseEventQuery(url.Values{})
+	if err != nil || q.Sort != mongo.SortDate || q.Limit != defaultSearchPageSize || q.After != nil {
+		t.Fatalf("unexpected defaults %+v, %v", q, err)
+	}
+	if q, _ := parseEventQuery(url.Values{"q": {"jazz"}}); q.Sort != mongo.SortRelevance {
+		t.Errorf("expected a text search to sort by relevance, got %s", q.Sort)
+	}
+
+	q, err = parseEventQuery(url.Values{
+		"venue": {"Arena"},
+		"from":  {"2026-11-01T00:00:00Z"},
+		"to":    {"2026-12-01T00:00:00Z"},
+		"sort":  {"-date"},
+		"limit": {"5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Venue != "Arena" || q.Sort != mongo.SortDateDesc || q.Limit != 5 || q.From.Month() != time.November || q.To.Month() != time.December {
+		t.Errorf("unexpected query %+v", q)
+	}
+
+	for name, values := range map[string]url.Values{
+		"unknown sort":         {"sort": {"price"}},
+		"relevance without q":  {"sort": {"relevance"}},
+		"bad time":             {"from": {"tomorrow"}},
+		"empty range":          {"from": {"2026-12-01T00:00:00Z"}, "to": {"2026-11-01T00:00:00Z"}},
+		"limit too large":      {"limit": {"101"}},
+		"garbage cursor":       {"cursor": {"!!"}},
+		"cursor of other sort": {"sort": {"name"}, "cursor": {encodeEventCursor(mongo.EventCursor{Sort: mongo.SortDate})}},
+	} {
+		if _, err := parseEventQuery(values); !errors.Is(err, domain.ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+}
+
+func TestNextEventCursor(t *testing.T) {
+	page := []mongo.EventDoc{
+		{ID: uuid.New(), Name: "Alpha", Date: time.Date(2026, 11, 1, 20, 0, 0, 0, time.UTC)},
+		{ID: uuid.New(), Name: "Beta", Date: time.Date(2026, 11, 2, 20, 0, 0, 0, time.UTC)},
+	}
+
+	cursor := nextEventCursor(mongo.EventQuery{Sort: mongo.SortDate}, page)
+	q, err := parseEventQuery(url.Values{"cursor": {encodeEventCursor(cursor)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.After.ID != page[1].ID || !q.After.Date.Equal(page[1].Date) {
+		t.Errorf("expected the cursor to resume after Beta, got %+v", q.After)
+	}
+
+	if cursor := nextEventCursor(mongo.EventQuery{Sort: mongo.SortName}, page); cursor.Name != "Beta" || cursor.ID != page[1].ID {
+		t.Errorf("expected a name cursor at Beta, got %+v", cursor)
+	}
+
+	after := &mongo.EventCursor{Sort: mongo.SortRelevance, Offset: 2}
+	if cursor := nextEventCursor(mongo.EventQuery{Sort: mongo.SortRelevance, After: after}, page); cursor.Offset != 4 {
+		t.Errorf("expected relevance to continue at offset 4, got %d", cursor.Offset)
+	}
+}
@@ -0,0 +1,269 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/outbox"
+)
+
+const (
+	streamPollInterval = 500 * time.Millisecond
+	streamPageSize     = 500
+	streamHeartbeat    = 15 * time.Second
+	streamRetry        = 3 * time.Second
+	// streamBuffer is how many updates a subscriber may lag behind before it
+	// is disconnected; it reconnects with Last-Event-ID and catches up.
+	streamBuffer = 64
+)
+
+// seatEvent is an outbox record as seen by the seat map: a set of seats and
+// general admission admissions of one event that changed to the same state.
+type seatEvent struct {
+	ID      uuid.UUID
+	EventID uuid.UUID
+	Cause   string
+	Seats   []seatAvailability
+	Pools   []poolChange
+}
+
+// poolChange is a number of admissions to a pool that moved to State, e.g.
+// from remaining to held when a hold is placed.
+type poolChange struct {
+	Pool     string           `json:"pool"`
+	Quantity int              `json:"quantity"`
+	State    domain.SeatState `json:"state"`
+}
+
+// seatEventFrom maps a hold or order outbox record to the seat and pool
+// states it implies; records that do not change availability are skipped.
+func seatEventFrom(rec crdb.OutboxRecord) (seatEvent, bool) {
+	var state domain.SeatState
+	switch rec.EventType {
+	case "hold.created", "hold.extended", "order.created", "order.awaiting_payment":
+		state = domain.SeatHeld
+	case "order.confirmed":
+		state = domain.SeatSold
+	case "hold.released", "hold.expired", "order.failed", "order.cancelled", "order.expired", "order.refunded":
+		state = domain.SeatAvailable
+	default:
+		return seatEvent{}, false
+	}
+
+	var payload struct {
+		EventID   uuid.UUID     `json:"event_id"`
+		Seats     []string      `json:"seats"`
+		Pools     []poolRequest `json:"pools"`
+		ExpiresAt string        `json:"expires_at"`
+	}
+	if err := json.Unmarshal(rec.Payload, &payload); err != nil || payload.EventID == uuid.Nil || len(payload.Seats)+len(payload.Pools) == 0 {
+		return seatEvent{}, false
+	}
+
+	var heldUntil *time.Time
+	if state == domain.SeatHeld && rec.AggregateType == "hold" {
+		if t, err := time.Parse(time.RFC3339, payload.ExpiresAt); err == nil {
+			heldUntil = &t
+		}
+	}
+	ev := seatEvent{ID: rec.ID, EventID: payload.EventID, Cause: rec.EventType, Seats: []seatAvailability{}}
+	for _, seat := range payload.Seats {
+		ev.Seats = append(ev.Seats, seatAvailability{SeatNo: seat, State: state, HeldUntil: heldUntil})
+	}
+	for _, pool := range payload.Pools {
+		ev.Pools = append(ev.Pools, poolChange{Pool: pool.Pool, Quantity: pool.Quantity, State: state})
+	}
+	return ev, true
+}
+
+// AvailabilityHub tails the hold and order outbox and fans seat and pool
+// changes out to the availability streams of this instance.
+type AvailabilityHub struct {
+	repo   *crdb.Repository
+	logger observability.Logger
+
+	mu   sync.Mutex
+	subs map[uuid.UUID]map[chan seatEvent]struct{}
+}
+
+func NewAvailabilityHub(repo *crdb.Repository, logger observability.Logger) *AvailabilityHub {
+	return &AvailabilityHub{repo: repo, logger: logger, subs: map[uuid.UUID]map[chan seatEvent]struct{}{}}
+}
+
+// Run polls the outbox until ctx is done and then closes every subscription,
+// which ends the open streams.
+func (h *AvailabilityHub) Run(ctx context.Context) {
+	defer h.closeAll()
+
+	outbox.Tail(ctx, h.repo, h.logger, streamPollInterval, []string{"hold", "order"}, func(records []crdb.OutboxRecord) {
+		for _, rec := range records {
+			if ev, ok := seatEventFrom(rec); ok {
+				h.publish(ev)
+			}
+		}
+	})
+}
+
+func (h *AvailabilityHub) subscribe(eventID uuid.UUID) (<-chan seatEvent, func()) {
+	ch := make(chan seatEvent, streamBuffer)
+	h.mu.Lock()
+	if h.subs[eventID] == nil {
+		h.subs[eventID] = map[chan seatEvent]struct{}{}
+	}
+	h.subs[eventID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[eventID][ch]; ok {
+			delete(h.subs[eventID], ch)
+			close(ch)
+		}
+		if len(h.subs[eventID]) == 0 {
+			delete(h.subs, eventID)
+		}
+	}
+}
+
+// publish never blocks: a subscriber whose buffer is full is dropped.
+func (h *AvailabilityHub) publish(ev seatEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[ev.EventID] {
+		select {
+		case ch <- ev:
+		default:
+			delete(h.subs[ev.EventID], ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *AvailabilityHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for eventID, chans := range h.subs {
+		for ch := range chans {
+			close(ch)
+		}
+		delete(h.subs, eventID)
+	}
+}
+
+// StreamAvailability sends seat and pool changes of an event as Server-Sent
+// Events.
+// Each message id is the outbox record id; a client reconnecting with
+// Last-Event-ID gets what it missed, or a "reset" event telling it to
+// refetch the seat map when the id is unknown.
+func (h *Handlers) StreamAvailability(w http.ResponseWriter, r *http.Request) {
+	eventID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
+		return
+	}
+	if event, err := h.mongoCatalog.GetEvent(r.Context(), eventID); err != nil || event.Status == domain.EventDraft {
+		writeProblem(w, r, http.StatusNotFound, codeEventNotFound, "event not found")
+		return
+	}
+
+	// Subscribe before replaying so nothing committed in between is lost;
+	// replayed ids are skipped when they also arrive live.
+	updates, unsubscribe := h.hub.subscribe(eventID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	replayed := map[uuid.UUID]bool{}
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		if err := h.replaySeatEvents(r.Context(), w, eventID, lastID, replayed); err != nil {
+			if !errors.Is(err, domain.ErrNotFound) {
+				h.hub.logger.Error("failed to replay availability stream", err)
+			}
+			writeSSE(w, "", "reset", []byte("{}"))
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case ev, ok := <-updates:
+			if !ok {
+				return
+			}
+			if replayed[ev.ID] {
+				continue
+			}
+			writeSeatEvent(w, ev)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (h *Handlers) replaySeatEvents(ctx context.Context, w http.ResponseWriter, eventID uuid.UUID, lastID string, replayed map[uuid.UUID]bool) error {
+	after, err := uuid.Parse(lastID)
+	if err != nil {
+		return domain.ErrNotFound
+	}
+	for {
+		records, err := h.repo.GetSeatOutboxAfter(ctx, eventID, after, streamPageSize)
+		if err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if ev, ok := seatEventFrom(rec); ok {
+				writeSeatEvent(w, ev)
+				replayed[ev.ID] = true
+			}
+			after = rec.ID
+		}
+		if len(records) < streamPageSize {
+			return nil
+		}
+	}
+}
+
+func writeSeatEvent(w http.ResponseWriter, ev seatEvent) {
+	msg := map[string]interface{}{
+		"event_id": ev.EventID,
+		"cause":    ev.Cause,
+		"seats":    ev.Seats,
+	}
+	if len(ev.Pools) > 0 {
+		msg["pools"] = ev.Pools
+	}
+	data, _ := json.Marshal(msg)
+	writeSSE(w, ev.ID.String(), "seats", data)
+}
+
+func writeSSE(w http.ResponseWriter, id, event string, data []byte) {
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
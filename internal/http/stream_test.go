@@ -0,0 +1,95 @@
+package http
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+func TestSeatEventFrom(t *testing.T) {
+	hold := domain.NewHold(uuid.New(), []string{"A1", "A2"}, uuid.New(), 5*time.Minute)
+
+	ev, ok := seatEventFrom(crdb.HoldOutboxRecord(hold, "hold.created"))
+	if !ok || ev.EventID != hold.EventID || ev.Cause != "hold.created" || len(ev.Seats) != 2 {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if ev.Seats[0].State != domain.SeatHeld || ev.Seats[0].HeldUntil == nil || !ev.Seats[0].HeldUntil.Equal(hold.ExpiresAt.Truncate(time.Second)) {
+		t.Errorf("expected held until the hold expires, got %+v", ev.Seats[0])
+	}
+
+	for eventType, want := range map[string]domain.SeatState{
+		"hold.expired":           domain.SeatAvailable,
+		"order.awaiting_payment": domain.SeatHeld,
+		"order.confirmed":        domain.SeatSold,
+		"order.refunded":         domain.SeatAvailable,
+	} {
+		rec := crdb.OutboxRecord{ID: uuid.New(), AggregateType: "order", EventType: eventType,
+			Payload: []byte(`{"event_id":"` + hold.EventID.String() + `","seats":["A1"]}`)}
+		ev, ok := seatEventFrom(rec)
+		if !ok || ev.Seats[0].State != want || ev.Seats[0].HeldUntil != nil {
+			t.Errorf("%s: expected %s, got %+v", eventType, want, ev)
+		}
+	}
+
+	gaHold := domain.NewHold(hold.EventID, nil, uuid.New(), 5*time.Minute)
+	gaHold.Pools = []domain.PoolQuantity{{Pool: "floor", Quantity: 3}}
+	ev, ok = seatEventFrom(crdb.HoldOutboxRecord(gaHold, "hold.released"))
+	if !ok || len(ev.Seats) != 0 || len(ev.Pools) != 1 || ev.Pools[0] != (poolChange{Pool: "floor", Quantity: 3, State: domain.SeatAvailable}) {
+		t.Errorf("expected the released admissions to be available again, got %+v", ev)
+	}
+
+	if _, ok := seatEventFrom(crdb.OutboxRecord{EventType: "order.confirmed", Payload: []byte(`{"order_id":"x"}`)}); ok {
+		t.Error("records without event and seats must be skipped")
+	}
+	if _, ok := seatEventFrom(crdb.HoldOutboxRecord(hold, "hold.force_released")); ok {
+		t.Error("unknown event types must be skipped")
+	}
+}
+
+func TestAvailabilityHub(t *testing.T) {
+	hub := NewAvailabilityHub(nil, nil)
+	eventID := uuid.New()
+	fast, unsubscribeFast := hub.subscribe(eventID)
+	defer unsubscribeFast()
+	slow, unsubscribeSlow := hub.subscribe(eventID)
+	other, unsubscribeOther := hub.subscribe(uuid.New())
+	defer unsubscribeOther()
+
+	for i := 0; i <= streamBuffer; i++ {
+		hub.publish(seatEvent{ID: uuid.New(), EventID: eventID})
+		<-fast
+	}
+	for range streamBuffer {
+		<-slow
+	}
+	if _, ok := <-slow; ok {
+		t.Fatal("a subscriber that falls behind must be disconnected")
+	}
+	unsubscribeSlow()
+	if len(other) != 0 {
+		t.Error("updates must only reach subscribers of their event")
+	}
+
+	hub.closeAll()
+	if _, ok := <-fast; ok {
+		t.Error("closeAll must end every subscription")
+	}
+}
+
+func TestWriteSeatEvent(t *testing.T) {
+	w := httptest.NewRecorder()
+	ev := seatEvent{ID: uuid.New(), EventID: uuid.New(), Cause: "order.confirmed",
+		Seats: []seatAvailability{{SeatNo: "A1", State: domain.SeatSold}}}
+	writeSeatEvent(w, ev)
+
+	want := "id: " + ev.ID.String() + "\nevent: seats\ndata: {"
+	if got := w.Body.String(); !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "}\n\n") ||
+		!strings.Contains(got, `"seats":[{"seat_no":"A1","state":"sold"}]`) {
+		t.Errorf("unexpected frame %q", got)
+	}
+}
@@ -0,0 +1,230 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/seating"
+)
+
+func (h *Handlers) CreateVenue(w http.ResponseWriter, r *http.Request) {
+	var venue mongo.VenueDoc
+	if err := json.NewDecoder(r.Body).Decode(&venue); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	if venue.Name == "" {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "name is required")
+		return
+	}
+	venue.ID = uuid.New()
+	venue.CreatedAt = time.Now()
+	if err := h.mongoCatalog.CreateVenue(r.Context(), venue); err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(venue)
+}
+
+// GetVenue returns a venue with a summary of each of its layouts.
+func (h *Handlers) GetVenue(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
+		return
+	}
+	venue, err := h.mongoCatalog.GetVenue(r.Context(), id)
+	if errors.Is(err, domain.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, codeVenueNotFound, "venue not found")
+		return
+	}
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	layouts, err := h.mongoCatalog.ListLayouts(r.Context(), id)
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		*mongo.VenueDoc
+		Layouts []mongo.LayoutDoc `json:"layouts"`
+	}{venue, layouts})
+}
+
+// ImportLayout adds a seating chart to a venue. The body is the chart as
+// JSON or, with Content-Type text/csv, one seat per line; the layout is
+// named by the name query parameter.
+func (h *Handlers) ImportLayout(w http.ResponseWriter, r *http.Request) {
+	venueID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "name is required")
+		return
+	}
+	if _, err := h.mongoCatalog.GetVenue(r.Context(), venueID); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			writeProblem(w, r, http.StatusNotFound, codeVenueNotFound, "venue not found")
+			return
+		}
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	parse := seating.ParseJSON
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+		parse = seating.ParseCSV
+	}
+	chart, err := parse(r.Body)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	layout := mongo.LayoutDoc{
+		ID:        uuid.New(),
+		VenueID:   venueID,
+		Name:      name,
+		SeatCount: chart.SeatCount(),
+		Sections:  layoutSections(chart),
+		CreatedAt: time.Now(),
+	}
+	if err := h.mongoCatalog.CreateLayout(r.Context(), layout); err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(layout)
+}
+
+func (h *Handlers) GetLayout(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid id")
+		return
+	}
+	layout, err := h.mongoCatalog.GetLayout(r.Context(), id)
+	if errors.Is(err, domain.ErrNotFound) {
+		writeProblem(w, r, http.StatusNotFound, codeLayoutNotFound, "layout not found")
+		return
+	}
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(layout)
+}
+
+// applyLayout replaces the seats of an event that uses a venue layout with
+// the layout's seats, priced by the event's zones and overrides.
+func (h *Handlers) applyLayout(ctx context.Context, doc *mongo.EventDoc) error {
+	if doc.LayoutID == nil {
+		if len(doc.PriceZones) > 0 || len(doc.Overrides) > 0 {
+			return fmt.Errorf("%w: price_zones and overrides need a layout_id", domain.ErrInvalidInput)
+		}
+		return nil
+	}
+	layout, err := h.mongoCatalog.GetLayout(ctx, *doc.LayoutID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return fmt.Errorf("%w: layout %s not found", domain.ErrInvalidInput, doc.LayoutID)
+	}
+	if err != nil {
+		return err
+	}
+	seats, err := eventSeats(*layout, doc.PriceZones, doc.Overrides)
+	if err != nil {
+		return err
+	}
+	doc.Seats = seats
+	return nil
+}
+
+// eventSeats applies zones and overrides to layout. Each seat's price zone
+// becomes its tier, so pricing rules can target zones.
+func eventSeats(layout mongo.LayoutDoc, zones []mongo.PriceZoneDoc, overrides []mongo.SeatOverrideDoc) ([]mongo.SeatDoc, error) {
+	priceZones := make([]seating.PriceZone, len(zones))
+	for i, zone := range zones {
+		priceZones[i] = seating.PriceZone{Name: zone.Name, Prices: zone.Prices}
+	}
+	seatOverrides := make([]seating.Override, len(overrides))
+	for i, o := range overrides {
+		seatOverrides[i] = seating.Override{Section: o.Section, Row: o.Row, Seats: o.Seats, Zone: o.Zone, Available: o.Available}
+	}
+
+	applied, err := seating.Apply(layoutChart(layout), priceZones, seatOverrides)
+	if err != nil {
+		return nil, err
+	}
+	seats := make([]mongo.SeatDoc, len(applied))
+	for i, seat := range applied {
+		seats[i] = mongo.SeatDoc{
+			Number:    seat.Number,
+			Row:       seat.Row,
+			Section:   seat.Section,
+			Tier:      seat.Zone,
+			Prices:    seat.Prices,
+			Available: seat.Available,
+			X:         seat.X,
+			Y:         seat.Y,
+		}
+		for _, attr := range seat.Attributes {
+			seats[i].Attributes = append(seats[i].Attributes, string(attr))
+		}
+	}
+	return seats, nil
+}
+
+func layoutSections(chart seating.Chart) []mongo.LayoutSectionDoc {
+	sections := make([]mongo.LayoutSectionDoc, len(chart.Sections))
+	for i, section := range chart.Sections {
+		sections[i] = mongo.LayoutSectionDoc{Name: section.Name, Zone: section.Zone, Rows: make([]mongo.LayoutRowDoc, len(section.Rows))}
+		for j, row := range section.Rows {
+			rowDoc := mongo.LayoutRowDoc{Name: row.Name, Seats: make([]mongo.LayoutSeatDoc, len(row.Seats))}
+			for k, seat := range row.Seats {
+				rowDoc.Seats[k] = mongo.LayoutSeatDoc{Number: seat.Number, X: seat.X, Y: seat.Y, Zone: seat.Zone}
+				for _, attr := range seat.Attributes {
+					rowDoc.Seats[k].Attributes = append(rowDoc.Seats[k].Attributes, string(attr))
+				}
+			}
+			sections[i].Rows[j] = rowDoc
+		}
+	}
+	return sections
+}
+
+func layoutChart(layout mongo.LayoutDoc) seating.Chart {
+	chart := seating.Chart{Sections: make([]seating.Section, len(layout.Sections))}
+	for i, section := range layout.Sections {
+		chart.Sections[i] = seating.Section{Name: section.Name, Zone: section.Zone, Rows: make([]seating.Row, len(section.Rows))}
+		for j, row := range section.Rows {
+			seats := make([]seating.Seat, len(row.Seats))
+			for k, seat := range row.Seats {
+				seats[k] = seating.Seat{Number: seat.Number, X: seat.X, Y: seat.Y, Zone: seat.Zone}
+				for _, attr := range seat.Attributes {
+					seats[k].Attributes = append(seats[k].Attributes, seating.Attribute(attr))
+				}
+			}
+			chart.Sections[i].Rows[j] = seating.Row{Name: row.Name, Seats: seats}
+		}
+	}
+	return chart
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/seating"
+)
+
+func TestEventSeats(t *testing.T) {
+	chart := seating.Chart{Sections: []seating.Section{
+		{Name: "Stalls", Zone: "stalls", Rows: []seating.Row{
+			{Name: "A", Seats: []seating.Seat{
+				{Number: "A1", X: 1, Y: 2, Attributes: []seating.Attribute{seating.Wheelchair}},
+				{Number: "A2", X: 2, Y: 2, Zone: "premium"},
+			}},
+		}},
+	}}
+	layout := mongo.LayoutDoc{Sections: layoutSections(chart)}
+	if got := layoutChart(layout); !reflect.DeepEqual(got, chart) {
+		t.Fatalf("layout does not round trip: got %+v", got)
+	}
+
+	off := false
+	seats, err := eventSeats(layout,
+		[]mongo.PriceZoneDoc{{Name: "stalls", Prices: map[string]int64{"EUR": 4000}}},
+		[]mongo.SeatOverrideDoc{{Seats: []string{"A2"}, Available: &off}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mongo.SeatDoc{
+		{Number: "A1", Row: "A", Section: "Stalls", Tier: "stalls", Prices: map[string]int64{"EUR": 4000}, Available: true, X: 1, Y: 2, Attributes: []string{"wheelchair"}},
+		{Number: "A2", Row: "A", Section: "Stalls", Tier: "premium", X: 2, Y: 2},
+	}
+	if !reflect.DeepEqual(seats, want) {
+		t.Fatalf("got %+v, want %+v", seats, want)
+	}
+
+	_, err = eventSeats(layout, []mongo.PriceZoneDoc{{Name: "stalls", Prices: map[string]int64{"EUR": 4000}}}, nil)
+	if !errors.Is(err, domain.ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput for unpriced premium seat, got %v", err)
+	}
+}
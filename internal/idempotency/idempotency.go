@@ -2,41 +2,234 @@ package idempotency
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"time"
 
-	redisadapter "github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/redis"
+	"github.com/google/uuid"
 )
 
+var (
+	// ErrInProgress means another request with the same key is still running.
+	ErrInProgress = errors.New("request with this idempotency key is in progress")
+	// ErrFingerprintMismatch means the key was first used for a different request.
+	ErrFingerprintMismatch = errors.New("idempotency key reused with a different request")
+	// ErrAlreadyProcessed means the write of an earlier request with the same
+	// key committed but its response was lost.
+	ErrAlreadyProcessed = errors.New("request with this idempotency key was already processed")
+)
+
+// AlreadyProcessedError is returned by Begin for a key whose write committed
+// without its response being stored, as when the process died in between.
+// It matches ErrAlreadyProcessed.
+type AlreadyProcessedError struct {
+	// Location is the resource the write created, if the handler named one.
+	Location string
+}
+
+func (e *AlreadyProcessedError) Error() string {
+	return ErrAlreadyProcessed.Error()
+}
+
+func (e *AlreadyProcessedError) Is(target error) bool {
+	return target == ErrAlreadyProcessed
+}
+
+const (
+	// lockTTL bounds how long a crashed request can block its key.
+	lockTTL = 30 * time.Second
+	// waitTimeout is how long a duplicate waits for the first request to
+	// finish before giving up with ErrInProgress.
+	waitTimeout  = 2 * time.Second
+	pollInterval = 50 * time.Millisecond
+)
+
+// Record is an in-progress marker while Status is zero and a stored
+// response once it is set. Committed is set by the durable store once the
+// guarded write has committed, with the Location of the claim.
+type Record struct {
+	Fingerprint string
+	Token       string              `json:",omitempty"`
+	Status      int                 `json:",omitempty"`
+	Header      map[string][]string `json:",omitempty"`
+	Result      []byte              `json:",omitempty"`
+	Committed   bool                `json:",omitempty"`
+	Location    string              `json:",omitempty"`
+}
+
+// Store persists idempotency records.
+type Store interface {
+	Get(ctx context.Context, key string) (*Record, error)
+	// Reserve stores rec only if key is unused and reports whether it did.
+	Reserve(ctx context.Context, key string, rec Record, ttl time.Duration) (bool, error)
+	Set(ctx context.Context, key string, rec Record, ttl time.Duration) error
+	// Release drops an in-progress record still owned by token.
+	Release(ctx context.Context, key, token string) error
+}
+
+// Idempotency coordinates a fast cache store with an optional durable one.
+// The cache serialises concurrent duplicates; the durable store is consulted
+// when the cache has no record, so a flushed cache cannot replay a request
+// whose write has already committed.
 type Idempotency struct {
-	redis *redisadapter.Idempotency
-	ttl   time.Duration
+	cache   Store
+	durable Store
+	ttl     time.Duration
 }
 
-func NewIdempotency(redis *redisadapter.Idempotency, ttl time.Duration) *Idempotency {
-	return &Idempotency{redis: redis, ttl: ttl}
+func NewIdempotency(cache, durable Store, ttl time.Duration) *Idempotency {
+	return &Idempotency{cache: cache, durable: durable, ttl: ttl}
 }
 
 type Response struct {
 	Status int
+	Header map[string][]string
 	Result []byte
 }
 
-func (i *Idempotency) Get(ctx context.Context, key string) (*Response, error) {
-	idempResp, err := i.redis.Get(ctx, key)
-	if err != nil || idempResp == nil {
-		return nil, err
+// Claim is a reservation of a key by the request that will produce its
+// response.
+type Claim struct {
+	Key         string
+	Fingerprint string
+	TTL         time.Duration
+	Token       string
+	// Location names the resource the guarded write creates. A handler sets
+	// it before the write commits so it is stored with the claim and can be
+	// reported if the response is lost.
+	Location string
+}
+
+type claimKey struct{}
+
+// WithClaim attaches claim to ctx so a repository transaction can record
+// it alongside the write it guards.
+func WithClaim(ctx context.Context, claim *Claim) context.Context {
+	return context.WithValue(ctx, claimKey{}, claim)
+}
+
+func ClaimFrom(ctx context.Context) (*Claim, bool) {
+	claim, _ := ctx.Value(claimKey{}).(*Claim)
+	return claim, claim != nil
+}
+
+// WithoutClaim hides the claim of ctx from repository transactions. It is
+// for writes that are safe to repeat and followed by a write to another
+// store: left uncommitted, the claim is released if that second write
+// fails, so the client can retry with the same key.
+func WithoutClaim(ctx context.Context) context.Context {
+	return context.WithValue(ctx, claimKey{}, (*Claim)(nil))
+}
+
+// Fingerprint identifies a request for the purpose of detecting a key
+// being reused for a different request.
+func Fingerprint(method, path, userID string, body []byte) string {
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(method), []byte(path), []byte(userID), body} {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin reserves key for the request identified by fingerprint, keeping
+// its response for ttl or the default TTL when ttl is zero. If the key
+// already has a stored response it is returned instead of a claim. A
+// duplicate that arrives while the first request is running waits briefly
+// for its response and otherwise fails with ErrInProgress, or with an
+// AlreadyProcessedError if that request's write committed but its response
+// never arrived.
+func (i *Idempotency) Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Claim, *Response, error) {
+	if ttl <= 0 {
+		ttl = i.ttl
+	}
+	claim := &Claim{Key: key, Fingerprint: fingerprint, TTL: ttl, Token: uuid.NewString()}
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		claimed, rec, err := i.reserve(ctx, claim)
+		if err != nil {
+			return nil, nil, err
+		}
+		if claimed {
+			return claim, nil, nil
+		}
+		if rec != nil {
+			if rec.Fingerprint != fingerprint {
+				return nil, nil, ErrFingerprintMismatch
+			}
+			if rec.Status != 0 {
+				return nil, &Response{Status: rec.Status, Header: rec.Header, Result: rec.Result}, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			if rec != nil && rec.Committed {
+				return nil, nil, &AlreadyProcessedError{Location: rec.Location}
+			}
+			return nil, nil, ErrInProgress
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// reserve tries to claim the key and otherwise returns the record that
+// holds it, which may be nil if it disappeared in between.
+func (i *Idempotency) reserve(ctx context.Context, claim *Claim) (bool, *Record, error) {
+	marker := Record{Fingerprint: claim.Fingerprint, Token: claim.Token}
+	ok, err := i.cache.Reserve(ctx, claim.Key, marker, lockTTL)
+	if err != nil {
+		if i.durable == nil {
+			return false, nil, err
+		}
+		// The cache is unreachable; the durable store alone still guards.
+		if ok, err = i.durable.Reserve(ctx, claim.Key, marker, lockTTL); err != nil || ok {
+			return ok, nil, err
+		}
+		rec, err := i.durable.Get(ctx, claim.Key)
+		return false, rec, err
+	}
+	if !ok {
+		rec, err := i.cache.Get(ctx, claim.Key)
+		return false, rec, err
+	}
+	if i.durable == nil {
+		return true, nil, nil
 	}
 
-	return &Response{
-		Status: idempResp.Status,
-		Result: idempResp.Result,
-	}, nil
+	rec, err := i.durable.Get(ctx, claim.Key)
+	if err != nil || rec != nil {
+		i.cache.Release(ctx, claim.Key, claim.Token)
+		return false, rec, err
+	}
+	return true, nil, nil
+}
+
+// Complete stores the response for a claimed key.
+func (i *Idempotency) Complete(ctx context.Context, claim *Claim, resp Response) error {
+	rec := Record{
+		Fingerprint: claim.Fingerprint,
+		Status:      resp.Status,
+		Header:      resp.Header,
+		Result:      resp.Result,
+	}
+	cacheErr := i.cache.Set(ctx, claim.Key, rec, claim.TTL)
+	if i.durable == nil {
+		return cacheErr
+	}
+	return errors.Join(cacheErr, i.durable.Set(ctx, claim.Key, rec, claim.TTL))
 }
 
-func (i *Idempotency) Set(ctx context.Context, key string, resp Response) error {
-	idempResp := redisadapter.IdempResponse{
-		Status: resp.Status,
-		Result: resp.Result,
+// Release drops an unfinished claim so the client can retry with the same
+// key. It is a no-op after Complete, and for a durable record committed
+// with the write it guards.
+func (i *Idempotency) Release(ctx context.Context, claim *Claim) error {
+	err := i.cache.Release(ctx, claim.Key, claim.Token)
+	if i.durable == nil {
+		return err
 	}
-	return i.redis.Set(ctx, key, idempResp, i.ttl)
+	return errors.Join(err, i.durable.Release(ctx, claim.Key, claim.Token))
 }
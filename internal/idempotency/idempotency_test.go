@@ -0,0 +1,149 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFingerprint(t *testing.T) {
+	base := Fingerprint("POST", "/v1/orders", "u1", []byte(`{"hold_id":"h"}`))
+	if base != Fingerprint("POST", "/v1/orders", "u1", []byte(`{"hold_id":"h"}`)) {
+		t.Fatal("expected identical requests to share a fingerprint")
+	}
+
+	variants := map[string]string{
+		"method": Fingerprint("PUT", "/v1/orders", "u1", []byte(`{"hold_id":"h"}`)),
+		"path":   Fingerprint("POST", "/v1/holds", "u1", []byte(`{"hold_id":"h"}`)),
+		"user":   Fingerprint("POST", "/v1/orders", "u2", []byte(`{"hold_id":"h"}`)),
+		"body":   Fingerprint("POST", "/v1/orders", "u1", []byte(`{"hold_id":"x"}`)),
+		// field boundaries are delimited, so shifting bytes between parts differs
+		"shifted": Fingerprint("POST", "/v1/ordersu", "1", []byte(`{"hold_id":"h"}`)),
+	}
+	for name, fp := range variants {
+		if fp == base {
+			t.Errorf("expected a different %s to change the fingerprint", name)
+		}
+	}
+}
+
+type memStore struct {
+	records map[string]Record
+	down    bool
+}
+
+func newMemStore() *memStore { return &memStore{records: map[string]Record{}} }
+
+func (m *memStore) Get(_ context.Context, key string) (*Record, error) {
+	if m.down {
+		return nil, errors.New("store down")
+	}
+	rec, ok := m.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (m *memStore) Reserve(_ context.Context, key string, rec Record, _ time.Duration) (bool, error) {
+	if m.down {
+		return false, errors.New("store down")
+	}
+	if _, ok := m.records[key]; ok {
+		return false, nil
+	}
+	m.records[key] = rec
+	return true, nil
+}
+
+func (m *memStore) Set(_ context.Context, key string, rec Record, _ time.Duration) error {
+	if m.down {
+		return errors.New("store down")
+	}
+	m.records[key] = rec
+	return nil
+}
+
+func (m *memStore) Release(_ context.Context, key, token string) error {
+	if rec, ok := m.records[key]; ok && rec.Token == token && rec.Status == 0 {
+		delete(m.records, key)
+	}
+	return nil
+}
+
+func TestIdempotency_Begin(t *testing.T) {
+	ctx := context.Background()
+	cache, durable := newMemStore(), newMemStore()
+	idemp := NewIdempotency(cache, durable, time.Hour)
+
+	claim, existing, err := idemp.Begin(ctx, "key-1", "fp", 0)
+	if err != nil || claim == nil || existing != nil {
+		t.Fatalf("expected a fresh claim, got %v %v %v", claim, existing, err)
+	}
+	if claim.TTL != time.Hour {
+		t.Errorf("expected default TTL, got %v", claim.TTL)
+	}
+	if _, _, err := idemp.Begin(ctx, "key-1", "other", 0); err != ErrFingerprintMismatch {
+		t.Errorf("expected fingerprint mismatch, got %v", err)
+	}
+
+	if err := idemp.Complete(ctx, claim, Response{Status: 201, Result: []byte("ok")}); err != nil {
+		t.Fatal(err)
+	}
+	idemp.Release(ctx, claim)
+	if _, resp, err := idemp.Begin(ctx, "key-1", "fp", 0); err != nil || resp == nil || resp.Status != 201 {
+		t.Errorf("expected the stored response to survive release, got %v %v", resp, err)
+	}
+
+	// A flushed cache falls back to the durable record.
+	delete(cache.records, "key-1")
+	if _, resp, err := idemp.Begin(ctx, "key-1", "fp", 0); err != nil || resp == nil || string(resp.Result) != "ok" {
+		t.Errorf("expected replay from the durable store, got %v %v", resp, err)
+	}
+	if _, ok := cache.records["key-1"]; ok {
+		t.Error("expected the cache reservation to be released after a durable hit")
+	}
+
+	// With the cache down the durable store takes the reservation.
+	cache.down = true
+	claim, _, err = idemp.Begin(ctx, "key-2", "fp", 0)
+	if err != nil || claim == nil || durable.records["key-2"].Token != claim.Token {
+		t.Errorf("expected a durable reservation while the cache is down, got %v %v", claim, err)
+	}
+}
+
+func TestIdempotency_BeginAfterLostResponse(t *testing.T) {
+	ctx := context.Background()
+	cache, durable := newMemStore(), newMemStore()
+	idemp := NewIdempotency(cache, durable, time.Hour)
+
+	// The order committed with its claim, then the process died before
+	// Complete, and the cache marker has run out since.
+	durable.records["key-1"] = Record{Fingerprint: "fp", Token: "t", Committed: true, Location: "/v1/orders/1"}
+
+	_, _, err := idemp.Begin(ctx, "key-1", "fp", 0)
+	var processed *AlreadyProcessedError
+	if !errors.As(err, &processed) || !errors.Is(err, ErrAlreadyProcessed) || processed.Location != "/v1/orders/1" {
+		t.Fatalf("expected the order to be reported as already processed, got %v", err)
+	}
+
+	// A claim that has not committed yet is still in progress.
+	durable.records["key-2"] = Record{Fingerprint: "fp", Token: "t"}
+	if _, _, err := idemp.Begin(ctx, "key-2", "fp", 0); !errors.Is(err, ErrInProgress) {
+		t.Errorf("expected ErrInProgress, got %v", err)
+	}
+}
+
+func TestWithoutClaim(t *testing.T) {
+	ctx := WithClaim(context.Background(), &Claim{Key: "order-0123456789"})
+	if claim, ok := ClaimFrom(ctx); !ok || claim.Key != "order-0123456789" {
+		t.Fatalf("expected the claim, got %v", claim)
+	}
+	if claim, ok := ClaimFrom(WithoutClaim(ctx)); ok || claim != nil {
+		t.Errorf("expected the claim to be hidden, got %v", claim)
+	}
+	if _, ok := ClaimFrom(context.Background()); ok {
+		t.Error("expected no claim on a bare context")
+	}
+}
@@ -2,11 +2,10 @@ package observability
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var (
-	RequestsTotal = promauto.NewCounterVec(
+	RequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "tro_requests_total",
 			Help: "Total number of requests",
@@ -14,7 +13,7 @@ var (
 		[]string{"route", "code", "method"},
 	)
 
-	DBTxDuration = promauto.NewHistogram(
+	DBTxDuration = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Name:    "tro_db_tx_seconds",
 			Help:    "Duration of DB transactions",
@@ -22,28 +21,50 @@ var (
 		},
 	)
 
-	OutboxLag = promauto.NewGauge(
+	DBTxRetries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "tro_db_tx_retries_total",
+			Help: "Total DB transaction attempts retried after a serialization failure",
+		},
+	)
+
+	OutboxLag = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "tro_outbox_lag_seconds",
 			Help: "Lag of outbox publishing",
 		},
 	)
 
-	RabbitPublishRetries = promauto.NewCounter(
+	RabbitPublishRetries = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "tro_rabbit_publish_retries_total",
 			Help: "Total rabbit publish retries",
 		},
 	)
 
-	RateLimitExceeded = promauto.NewCounter(
+	RateLimitExceeded = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "tro_rate_limit_exceeded_total",
 			Help: "Total rate limit exceeded",
 		},
 	)
+
+	CatalogSeatDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tro_catalog_drift_seats",
+			Help: "Catalog seats found to differ from CockroachDB in the last reconciliation",
+		},
+		[]string{"kind"},
+	)
+
+	RateLimitBackendErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "tro_rate_limit_backend_errors_total",
+			Help: "Total rate limit checks that could not reach Redis",
+		},
+	)
 )
 
 func InitMetrics() {
-	prometheus.MustRegister(RequestsTotal, DBTxDuration, OutboxLag, RabbitPublishRetries, RateLimitExceeded)
+	prometheus.MustRegister(RequestsTotal, DBTxDuration, DBTxRetries, OutboxLag, RabbitPublishRetries, RateLimitExceeded, RateLimitBackendErrors, CatalogSeatDrift)
 }
@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
+)
+
+const projectorPollInterval = time.Second
+
+// Projector keeps the per-seat and per-pool availability in the Mongo
+// catalog current. It tails the hold, order and event records of the outbox
+// and re-projects the seats they name, and the pools of their event, from
+// CockroachDB rather than applying the records, so
+// a record seen twice or out of order does no harm. Whatever it misses while
+// down is repaired by the Reconciler.
+type Projector struct {
+	repo    *crdb.Repository
+	catalog *mongo.CatalogRepository
+	logger  observability.Logger
+}
+
+func NewProjector(repo *crdb.Repository, catalog *mongo.CatalogRepository, logger observability.Logger) *Projector {
+	return &Projector{repo: repo, catalog: catalog, logger: logger}
+}
+
+func (p *Projector) Run(ctx context.Context) {
+	Tail(ctx, p.repo, p.logger, projectorPollInterval, []string{"hold", "order", "event"}, func(records []crdb.OutboxRecord) {
+		// Seats to project per event; a nil set means every seat.
+		touched := map[uuid.UUID]map[string]bool{}
+		for _, rec := range records {
+			collectTouched(touched, rec)
+		}
+		for eventID, seats := range touched {
+			if err := projectEvent(ctx, p.repo, p.catalog, eventID, seats); err != nil {
+				p.logger.WithField("event_id", eventID).Error("failed to project seats", err)
+			}
+		}
+	})
+}
+
+// collectTouched adds the seats rec names to touched. Event records replace
+// the catalog entry, so all of its seats are projected again. A record that
+// names no seats, such as a general admission hold, still touches its event
+// so that its pools are projected.
+func collectTouched(touched map[uuid.UUID]map[string]bool, rec crdb.OutboxRecord) {
+	var payload struct {
+		EventID uuid.UUID `json:"event_id"`
+		Seats   []string  `json:"seats"`
+	}
+	if err := json.Unmarshal(rec.Payload, &payload); err != nil || payload.EventID == uuid.Nil {
+		return
+	}
+	seats, ok := touched[payload.EventID]
+	if rec.AggregateType == "event" {
+		touched[payload.EventID] = nil
+		return
+	}
+	if ok && seats == nil {
+		return
+	}
+	if seats == nil {
+		seats = map[string]bool{}
+		touched[payload.EventID] = seats
+	}
+	for _, seat := range payload.Seats {
+		seats[seat] = true
+	}
+}
+
+// projectEvent writes the CockroachDB view of the given seats of an event,
+// or of all its seats if seats is nil, and of all its pools to the catalog.
+// Pools are few, so they are always projected whole.
+func projectEvent(ctx context.Context, repo *crdb.Repository, catalog *mongo.CatalogRepository, eventID uuid.UUID, seats map[string]bool) error {
+	inventory, err := repo.GetSeatInventory(ctx, eventID)
+	if err != nil {
+		return err
+	}
+	occupied, err := repo.GetSeatOccupancy(ctx, eventID, time.Now())
+	if err != nil {
+		return err
+	}
+	projections := map[string]mongo.SeatProjection{}
+	for seat := range inventory {
+		if seats == nil || seats[seat] {
+			projections[seat] = seatProjection(seat, inventory, occupied)
+		}
+	}
+	if err := catalog.ProjectSeats(ctx, eventID, projections); err != nil {
+		return err
+	}
+
+	pools, err := repo.GetPoolAvailability(ctx, eventID, time.Now())
+	if err != nil {
+		return err
+	}
+	poolProjections := make(map[string]mongo.PoolProjection, len(pools))
+	for id, pool := range pools {
+		poolProjections[id] = poolProjection(pool)
+	}
+	return catalog.ProjectPools(ctx, eventID, poolProjections)
+}
+
+func seatProjection(seat string, inventory map[string]bool, occupied map[string]domain.SeatOccupancy) mongo.SeatProjection {
+	projection := mongo.SeatProjection{Available: inventory[seat], State: domain.SeatAvailable}
+	if o, ok := occupied[seat]; ok {
+		projection.State = o.State
+	}
+	return projection
+}
+
+func poolProjection(pool domain.PoolAvailability) mongo.PoolProjection {
+	return mongo.PoolProjection{Available: pool.Sellable, Remaining: pool.Remaining()}
+}
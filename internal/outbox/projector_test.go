@@ -0,0 +1,43 @@
+package outbox
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
+)
+
+func TestCollectTouched(t *testing.T) {
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	record := func(aggregate string, eventID uuid.UUID, seats ...string) crdb.OutboxRecord {
+		payload, _ := json.Marshal(map[string]interface{}{"event_id": eventID, "seats": seats})
+		return crdb.OutboxRecord{ID: uuid.New(), AggregateType: aggregate, Payload: payload}
+	}
+
+	touched := map[uuid.UUID]map[string]bool{}
+	for _, rec := range []crdb.OutboxRecord{
+		record("hold", first, "A1", "A2"),
+		record("order", first, "A3"),
+		record("hold", second, "B1"),
+		record("event", second),
+		record("hold", second, "B2"),
+		record("hold", third),
+		{ID: uuid.New(), AggregateType: "hold", Payload: []byte(`{}`)},
+	} {
+		collectTouched(touched, rec)
+	}
+
+	if len(touched) != 3 {
+		t.Fatalf("expected three events, got %v", touched)
+	}
+	if seats := touched[first]; len(seats) != 3 || !seats["A1"] || !seats["A3"] {
+		t.Errorf("expected A1-A3 of the first event, got %v", seats)
+	}
+	if seats, ok := touched[second]; !ok || seats != nil {
+		t.Errorf("expected every seat of the updated event, got %v", seats)
+	}
+	if seats, ok := touched[third]; !ok || seats == nil || len(seats) != 0 {
+		t.Errorf("expected a hold without seats to touch only the pools of its event, got %v", seats)
+	}
+}
@@ -0,0 +1,199 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
+)
+
+const reconcilePageSize = 100
+
+// DriftKind says how a catalog seat or pool disagrees with CockroachDB.
+type DriftKind string
+
+const (
+	// DriftMissingEvent: CockroachDB has the event but the catalog does not.
+	DriftMissingEvent DriftKind = "missing_event"
+	// DriftMissingSeat: a sellable seat is not listed in the catalog, so it
+	// cannot be priced or shown.
+	DriftMissingSeat DriftKind = "missing_seat"
+	// DriftUnknownSeat: the catalog lists a seat CockroachDB does not have.
+	DriftUnknownSeat DriftKind = "unknown_seat"
+	// DriftAvailability: the seat's available flag or state, or the pool's
+	// available flag or remaining count, is stale.
+	DriftAvailability DriftKind = "availability"
+)
+
+// SeatDrift is one disagreement found by the Reconciler, about a seat or,
+// with Pool set, a general admission pool.
+type SeatDrift struct {
+	SeatNo string
+	Pool   string
+	Kind   DriftKind
+}
+
+// Reconciler periodically compares the seats and pools of every event in
+// the catalog with CockroachDB. Stale availability is re-projected; seats and
+// pools missing on either side need an admin update of the event and are only reported.
+type Reconciler struct {
+	repo    *crdb.Repository
+	catalog *mongo.CatalogRepository
+	logger  observability.Logger
+}
+
+func NewReconciler(repo *crdb.Repository, catalog *mongo.CatalogRepository, logger observability.Logger) *Reconciler {
+	return &Reconciler{repo: repo, catalog: catalog, logger: logger}
+}
+
+// Run reconciles once straight away and then every interval.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Reconcile(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("failed to reconcile catalog", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile checks every event and updates the tro_catalog_drift_seats
+// gauge with what it found.
+func (r *Reconciler) Reconcile(ctx context.Context) error {
+	totals := map[DriftKind]int{}
+	var after uuid.UUID
+	for {
+		ids, err := r.repo.GetEventIDs(ctx, after, reconcilePageSize)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			drift, err := r.reconcileEvent(ctx, id)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				r.logger.WithField("event_id", id).Error("failed to reconcile event", err)
+			}
+			for _, d := range drift {
+				totals[d.Kind]++
+			}
+			if len(drift) > 0 {
+				r.logger.WithField("event_id", id).WithField("drift", len(drift)).Warn("catalog seats differ from inventory")
+			}
+		}
+		if len(ids) < reconcilePageSize {
+			break
+		}
+		after = ids[len(ids)-1]
+	}
+
+	for _, kind := range []DriftKind{DriftMissingEvent, DriftMissingSeat, DriftUnknownSeat, DriftAvailability} {
+		observability.CatalogSeatDrift.WithLabelValues(string(kind)).Set(float64(totals[kind]))
+	}
+	return nil
+}
+
+func (r *Reconciler) reconcileEvent(ctx context.Context, eventID uuid.UUID) ([]SeatDrift, error) {
+	event, err := r.catalog.GetEvent(ctx, eventID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return []SeatDrift{{Kind: DriftMissingEvent}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	inventory, err := r.repo.GetSeatInventory(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	occupied, err := r.repo.GetSeatOccupancy(ctx, eventID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	pools, err := r.repo.GetPoolAvailability(ctx, eventID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	drift := DiffSeats(event.Seats, inventory, occupied)
+	stale := map[string]mongo.SeatProjection{}
+	for _, d := range drift {
+		if d.Kind == DriftAvailability {
+			stale[d.SeatNo] = seatProjection(d.SeatNo, inventory, occupied)
+		}
+	}
+	if err := r.catalog.ProjectSeats(ctx, eventID, stale); err != nil {
+		return drift, err
+	}
+
+	poolDrift := DiffPools(event.Pools, pools)
+	stalePools := map[string]mongo.PoolProjection{}
+	for _, d := range poolDrift {
+		if d.Kind == DriftAvailability {
+			stalePools[d.Pool] = poolProjection(pools[d.Pool])
+		}
+	}
+	return append(drift, poolDrift...), r.catalog.ProjectPools(ctx, eventID, stalePools)
+}
+
+// DiffSeats compares the catalog seats of an event with its inventory and
+// occupancy in CockroachDB. Unsellable seats the catalog leaves out are kept
+// only for history and do not count as drift.
+func DiffSeats(seats []mongo.SeatDoc, inventory map[string]bool, occupied map[string]domain.SeatOccupancy) []SeatDrift {
+	var drift []SeatDrift
+	listed := make(map[string]bool, len(seats))
+	for _, seat := range seats {
+		listed[seat.Number] = true
+		if _, ok := inventory[seat.Number]; !ok {
+			drift = append(drift, SeatDrift{SeatNo: seat.Number, Kind: DriftUnknownSeat})
+			continue
+		}
+		want := seatProjection(seat.Number, inventory, occupied)
+		if seat.Available != want.Available || seat.State != want.State {
+			drift = append(drift, SeatDrift{SeatNo: seat.Number, Kind: DriftAvailability})
+		}
+	}
+	for seat, sellable := range inventory {
+		if sellable && !listed[seat] {
+			drift = append(drift, SeatDrift{SeatNo: seat, Kind: DriftMissingSeat})
+		}
+	}
+	return drift
+}
+
+// DiffPools compares the catalog pools of an event with its pools in
+// CockroachDB, the way DiffSeats does for seats.
+func DiffPools(catalog []mongo.PoolDoc, pools map[string]domain.PoolAvailability) []SeatDrift {
+	var drift []SeatDrift
+	listed := make(map[string]bool, len(catalog))
+	for _, doc := range catalog {
+		listed[doc.ID] = true
+		pool, ok := pools[doc.ID]
+		if !ok {
+			drift = append(drift, SeatDrift{Pool: doc.ID, Kind: DriftUnknownSeat})
+			continue
+		}
+		want := poolProjection(pool)
+		if doc.Available != want.Available || doc.Remaining == nil || *doc.Remaining != want.Remaining {
+			drift = append(drift, SeatDrift{Pool: doc.ID, Kind: DriftAvailability})
+		}
+	}
+	for id, pool := range pools {
+		if pool.Sellable && !listed[id] {
+			drift = append(drift, SeatDrift{Pool: id, Kind: DriftMissingSeat})
+		}
+	}
+	return drift
+}
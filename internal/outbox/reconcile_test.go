@@ -0,0 +1,88 @@
+package outbox
+
+import (
+	"testing"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+func TestDiffSeats(t *testing.T) {
+	seats := []mongo.SeatDoc{
+		{Number: "A1", Available: true, State: domain.SeatAvailable},
+		{Number: "A2", Available: true, State: domain.SeatAvailable},
+		{Number: "A3", Available: true},
+		{Number: "A4", Available: true, State: domain.SeatAvailable},
+		{Number: "Z9", Available: true, State: domain.SeatAvailable},
+	}
+	inventory := map[string]bool{"A1": true, "A2": true, "A3": true, "A4": false, "A5": true, "OLD": false}
+	occupied := map[string]domain.SeatOccupancy{"A2": {State: domain.SeatSold}}
+
+	got := map[string]DriftKind{}
+	for _, d := range DiffSeats(seats, inventory, occupied) {
+		got[d.SeatNo] = d.Kind
+	}
+	want := map[string]DriftKind{
+		"A2": DriftAvailability, // sold in CockroachDB
+		"A3": DriftAvailability, // never projected
+		"A4": DriftAvailability, // no longer sellable
+		"A5": DriftMissingSeat,
+		"Z9": DriftUnknownSeat,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for seat, kind := range want {
+		if got[seat] != kind {
+			t.Errorf("%s: expected %s, got %s", seat, kind, got[seat])
+		}
+	}
+}
+
+func TestDiffPools(t *testing.T) {
+	ten, three := 10, 3
+	catalog := []mongo.PoolDoc{
+		{ID: "standing", Available: true, Remaining: &ten},
+		{ID: "vip", Available: true, Remaining: &ten},
+		{ID: "balcony", Available: true},
+		{ID: "gone", Available: true, Remaining: &three},
+	}
+	pools := map[string]domain.PoolAvailability{
+		"standing": {Capacity: 12, Held: 2, Sellable: true},
+		"vip":      {Capacity: 10, Sold: 7, Sellable: true},
+		"balcony":  {Capacity: 5, Sellable: true},
+		"lawn":     {Capacity: 100, Sellable: true},
+		"old":      {Capacity: 50},
+	}
+
+	got := map[string]DriftKind{}
+	for _, d := range DiffPools(catalog, pools) {
+		got[d.Pool] = d.Kind
+	}
+	want := map[string]DriftKind{
+		"vip":     DriftAvailability, // seven sold since the last projection
+		"balcony": DriftAvailability, // never projected
+		"gone":    DriftUnknownSeat,
+		"lawn":    DriftMissingSeat,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for pool, kind := range want {
+		if got[pool] != kind {
+			t.Errorf("%s: expected %s, got %s", pool, kind, got[pool])
+		}
+	}
+}
+
+func TestSeatProjection(t *testing.T) {
+	inventory := map[string]bool{"A1": true, "A2": false}
+	occupied := map[string]domain.SeatOccupancy{"A2": {State: domain.SeatHeld}}
+
+	if p := seatProjection("A1", inventory, occupied); !p.Available || p.State != domain.SeatAvailable {
+		t.Errorf("expected A1 available, got %+v", p)
+	}
+	if p := seatProjection("A2", inventory, occupied); p.Available || p.State != domain.SeatHeld {
+		t.Errorf("expected A2 unsellable but still held, got %+v", p)
+	}
+}
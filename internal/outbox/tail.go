@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
+)
+
+const (
+	// tailClockSkew covers the clock offset CockroachDB tolerates between
+	// nodes, since created_at is stamped by whichever node ran the
+	// transaction.
+	tailClockSkew = time.Second
+	tailPageSize  = 500
+)
+
+// settleWindow is how far behind the newest record the outbox is re-read: a
+// transaction stamps created_at when it starts, so its records can commit
+// after records with a later created_at were already read, but never later
+// than the repository's transaction timeout after it.
+func settleWindow(repo *crdb.Repository) time.Duration {
+	return repo.TxTimeout() + tailClockSkew
+}
+
+// Tail polls the outbox every interval until ctx is done and passes the
+// records of aggregateTypes that were written since the last poll to handle,
+// oldest first. Each record is handed over once, even though the outbox is
+// re-read for a settle window to catch late commits. Records written before
+// Tail starts are not handed over.
+func Tail(ctx context.Context, repo *crdb.Repository, logger observability.Logger, interval time.Duration, aggregateTypes []string, handle func([]crdb.OutboxRecord)) {
+	t := newTail(time.Now(), settleWindow(repo), func(ctx context.Context, since time.Time, afterID uuid.UUID, limit int) ([]crdb.OutboxRecord, error) {
+		return repo.GetOutboxSince(ctx, since, afterID, limit, aggregateTypes...)
+	})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		records, err := t.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.WithField("aggregate_types", aggregateTypes).Error("failed to read outbox", err)
+		}
+		if len(records) > 0 {
+			handle(records)
+		}
+	}
+}
+
+// readOutbox reads up to limit records after (since, afterID) in
+// (created_at, id) order.
+type readOutbox func(ctx context.Context, since time.Time, afterID uuid.UUID, limit int) ([]crdb.OutboxRecord, error)
+
+// tail is the state Tail keeps between polls: the newest created_at read so
+// far and the records read within the settle window behind it.
+type tail struct {
+	read      readOutbox
+	pageSize  int
+	settle    time.Duration
+	watermark time.Time
+	seen      map[uuid.UUID]time.Time
+}
+
+func newTail(start time.Time, settle time.Duration, read readOutbox) *tail {
+	return &tail{read: read, pageSize: tailPageSize, settle: settle, watermark: start, seen: map[uuid.UUID]time.Time{}}
+}
+
+// poll returns the records not returned before. On a read error it returns
+// what it read up to then along with the error.
+func (t *tail) poll(ctx context.Context) ([]crdb.OutboxRecord, error) {
+	var fresh []crdb.OutboxRecord
+	var err error
+	since, afterID := t.watermark.Add(-t.settle), uuid.Nil
+	for {
+		var records []crdb.OutboxRecord
+		records, err = t.read(ctx, since, afterID, t.pageSize)
+		if err != nil {
+			break
+		}
+		for _, rec := range records {
+			if _, ok := t.seen[rec.ID]; ok {
+				continue
+			}
+			t.seen[rec.ID] = rec.CreatedAt
+			if rec.CreatedAt.After(t.watermark) {
+				t.watermark = rec.CreatedAt
+			}
+			fresh = append(fresh, rec)
+		}
+		if len(records) < t.pageSize {
+			break
+		}
+		last := records[len(records)-1]
+		since, afterID = last.CreatedAt, last.ID
+	}
+
+	for id, createdAt := range t.seen {
+		if createdAt.Before(t.watermark.Add(-t.settle)) {
+			delete(t.seen, id)
+		}
+	}
+	return fresh, err
+}
@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
+)
+
+// fakeOutbox pages over its records the way GetOutboxSince does.
+type fakeOutbox struct {
+	records []crdb.OutboxRecord
+}
+
+func (f *fakeOutbox) add(createdAt time.Time) crdb.OutboxRecord {
+	rec := crdb.OutboxRecord{ID: uuid.New(), CreatedAt: createdAt}
+	f.records = append(f.records, rec)
+	sort.Slice(f.records, func(i, j int) bool { return outboxLess(f.records[i], f.records[j].CreatedAt, f.records[j].ID) })
+	return rec
+}
+
+func outboxLess(rec crdb.OutboxRecord, createdAt time.Time, id uuid.UUID) bool {
+	if !rec.CreatedAt.Equal(createdAt) {
+		return rec.CreatedAt.Before(createdAt)
+	}
+	return bytes.Compare(rec.ID[:], id[:]) < 0
+}
+
+func (f *fakeOutbox) read(_ context.Context, since time.Time, afterID uuid.UUID, limit int) ([]crdb.OutboxRecord, error) {
+	var page []crdb.OutboxRecord
+	for _, rec := range f.records {
+		if outboxLess(rec, since, afterID) || (rec.CreatedAt.Equal(since) && rec.ID == afterID) {
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+		page = append(page, rec)
+	}
+	return page, nil
+}
+
+func TestTailPoll(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	outbox := &fakeOutbox{}
+	settle := settleWindow(crdb.NewRepository(nil, crdb.RetryPolicy{}))
+	tail := newTail(start, settle, outbox.read)
+	tail.pageSize = 2
+
+	// Records of one transaction share a created_at and straddle a page.
+	stamp := start.Add(time.Second)
+	for i := 0; i < 3; i++ {
+		outbox.add(stamp)
+	}
+	records, err := tail.poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected all three records sharing a created_at, got %d", len(records))
+	}
+
+	if records, _ := tail.poll(ctx); len(records) != 0 {
+		t.Errorf("expected records to be handed over once, got %d again", len(records))
+	}
+
+	// A record that commits late with an earlier created_at is still read
+	// within the settle window, and one older than that is not.
+	late := outbox.add(stamp.Add(-time.Second))
+	outbox.add(stamp.Add(-settle - time.Second))
+	records, err = tail.poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != late.ID {
+		t.Errorf("expected only the late record, got %+v", records)
+	}
+
+	// A transaction that used up its retries commits long after it stamped
+	// created_at, while newer records have moved the watermark on.
+	outbox.add(stamp.Add(10 * time.Second))
+	if records, _ := tail.poll(ctx); len(records) != 1 {
+		t.Fatalf("expected the newer record, got %d", len(records))
+	}
+	retried := outbox.add(stamp.Add(10*time.Second - settle + tailClockSkew))
+	records, err = tail.poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != retried.ID {
+		t.Errorf("expected the record committed at the transaction timeout, got %+v", records)
+	}
+}
+
+func TestSettleWindow(t *testing.T) {
+	// Five attempts that each wait out the longest backoff must still fit.
+	repo := crdb.NewRepository(nil, crdb.RetryPolicy{MaxAttempts: 5, MaxDelay: time.Second})
+	if window := settleWindow(repo); window < 5*time.Second+tailClockSkew {
+		t.Errorf("expected the settle window to cover the retry policy, got %v", window)
+	}
+}
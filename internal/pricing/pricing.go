@@ -0,0 +1,150 @@
+package pricing
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+const (
+	ComponentBase = "BASE"
+	ComponentTier = "TIER"
+	ComponentFee  = "FEE"
+	ComponentTax  = "TAX"
+)
+
+// Seat carries the catalog price of a seat in the currency being quoted.
+type Seat struct {
+	Number  string
+	Section string
+	Tier    string
+	Price   domain.Money
+}
+
+// Pool carries the catalog price of one admission to a general admission
+// pool in the currency being quoted.
+type Pool struct {
+	ID    string
+	Tier  string
+	Price domain.Money
+}
+
+// TierRule adjusts the catalog price of every seat in Section, or of every
+// seat carrying Tier when Section is empty. Rates are in basis points, so a
+// MultiplierBP of 15000 is 1.5x and zero leaves the price unchanged.
+type TierRule struct {
+	Name         string
+	Section      string
+	Tier         string
+	MultiplierBP int64
+	Surcharge    int64
+}
+
+type Fee struct {
+	Name      string
+	Flat      int64
+	PercentBP int64
+}
+
+// Rules are expressed in the minor units of Currency.
+type Rules struct {
+	Currency  string
+	Tiers     []TierRule
+	Fees      []Fee
+	TaxName   string
+	TaxRateBP int64
+}
+
+type Engine struct {
+	rules Rules
+}
+
+func NewEngine(rules Rules) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Price returns one order item per requested seat with its full breakdown.
+func (e *Engine) Price(eventID uuid.UUID, catalog []Seat, seats []string) ([]domain.OrderItem, error) {
+	bySeat := make(map[string]Seat, len(catalog))
+	for _, s := range catalog {
+		bySeat[s.Number] = s
+	}
+
+	items := make([]domain.OrderItem, 0, len(seats))
+	for _, seatNo := range seats {
+		seat, ok := bySeat[seatNo]
+		if !ok || seat.Price.Currency != e.rules.Currency {
+			return nil, fmt.Errorf("%w: seat %s has no %s catalog price", domain.ErrInvalidInput, seatNo, e.rules.Currency)
+		}
+		items = append(items, e.priceSeat(eventID, seat))
+	}
+	return items, nil
+}
+
+// PricePools returns one order item per requested pool, priced per
+// admission like a seat of the pool's tier.
+func (e *Engine) PricePools(eventID uuid.UUID, catalog []Pool, pools []domain.PoolQuantity) ([]domain.OrderItem, error) {
+	byID := make(map[string]Pool, len(catalog))
+	for _, p := range catalog {
+		byID[p.ID] = p
+	}
+
+	items := make([]domain.OrderItem, 0, len(pools))
+	for _, requested := range pools {
+		pool, ok := byID[requested.Pool]
+		if !ok || pool.Price.Currency != e.rules.Currency {
+			return nil, fmt.Errorf("%w: pool %s has no %s catalog price", domain.ErrInvalidInput, requested.Pool, e.rules.Currency)
+		}
+		item := e.priceSeat(eventID, Seat{Tier: pool.Tier, Price: pool.Price})
+		item.Pool, item.Quantity = pool.ID, requested.Quantity
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (e *Engine) priceSeat(eventID uuid.UUID, seat Seat) domain.OrderItem {
+	currency := e.rules.Currency
+	item := domain.OrderItem{EventID: eventID, SeatNo: seat.Number, Quantity: 1, Price: domain.NewMoney(0, currency)}
+	add := func(kind, name string, amount domain.Money) {
+		item.Breakdown = append(item.Breakdown, domain.PriceComponent{Kind: kind, Name: name, Amount: amount})
+		item.Price.Amount += amount.Amount
+	}
+
+	add(ComponentBase, "ticket", seat.Price)
+	if rule, ok := e.tierRule(seat); ok {
+		adjusted := seat.Price
+		if rule.MultiplierBP != 0 {
+			adjusted = seat.Price.MulBP(rule.MultiplierBP)
+		}
+		adjusted.Amount += rule.Surcharge
+		add(ComponentTier, rule.Name, domain.NewMoney(adjusted.Amount-seat.Price.Amount, currency))
+	}
+
+	subtotal := item.Price
+	for _, fee := range e.rules.Fees {
+		add(ComponentFee, fee.Name, domain.NewMoney(fee.Flat+subtotal.MulBP(fee.PercentBP).Amount, currency))
+	}
+
+	if e.rules.TaxRateBP > 0 {
+		add(ComponentTax, e.rules.TaxName, item.Price.MulBP(e.rules.TaxRateBP))
+	}
+	return item
+}
+
+// tierRule prefers a section match over a tier match.
+func (e *Engine) tierRule(seat Seat) (TierRule, bool) {
+	var tierMatch *TierRule
+	for i, rule := range e.rules.Tiers {
+		if rule.Section != "" && rule.Section == seat.Section {
+			return rule, true
+		}
+		if tierMatch == nil && rule.Section == "" && rule.Tier != "" && rule.Tier == seat.Tier {
+			tierMatch = &e.rules.Tiers[i]
+		}
+	}
+	if tierMatch != nil {
+		return *tierMatch, true
+	}
+	return TierRule{}, false
+}
@@ -0,0 +1,86 @@
+package pricing_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/pricing"
+)
+
+func TestEngine_Price(t *testing.T) {
+	engine := pricing.NewEngine(pricing.Rules{
+		Currency: "EUR",
+		Tiers: []pricing.TierRule{
+			{Name: "vip", Tier: "VIP", MultiplierBP: 15000},
+			{Name: "front row", Section: "Floor", Surcharge: 2000},
+		},
+		Fees:      []pricing.Fee{{Name: "service", Flat: 200, PercentBP: 1000}},
+		TaxName:   "VAT",
+		TaxRateBP: 2000,
+	})
+	catalog := []pricing.Seat{
+		{Number: "A1", Section: "Floor", Tier: "VIP", Price: domain.NewMoney(10000, "EUR")},
+		{Number: "B1", Section: "Balcony", Tier: "VIP", Price: domain.NewMoney(5000, "EUR")},
+		{Number: "C1", Section: "Balcony", Price: domain.NewMoney(3333, "EUR")},
+		{Number: "D1", Section: "Balcony", Price: domain.NewMoney(3333, "USD")},
+	}
+
+	tests := []struct {
+		seat  string
+		price string
+		parts int
+	}{
+		// section rule wins over tier: (100+20) + (2+12) fees = 134, +20% tax = 160.80
+		{seat: "A1", price: "160.80", parts: 4},
+		// 50*1.5 = 75, fees 2+7.50 = 84.50, +20% tax = 101.40
+		{seat: "B1", price: "101.40", parts: 4},
+		// 33.33, fees 2+3.33 = 38.66, +20% tax 7.73 = 46.39
+		{seat: "C1", price: "46.39", parts: 3},
+	}
+	for _, tt := range tests {
+		items, err := engine.Price(uuid.New(), catalog, []string{tt.seat})
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.seat, err)
+		}
+		if items[0].Price.Decimal() != tt.price || items[0].Price.Currency != "EUR" || len(items[0].Breakdown) != tt.parts {
+			t.Errorf("%s: expected %s EUR in %d parts, got %v in %v", tt.seat, tt.price, tt.parts, items[0].Price, items[0].Breakdown)
+		}
+	}
+
+	for _, seat := range []string{"Z9", "D1"} {
+		_, err := engine.Price(uuid.New(), catalog, []string{seat})
+		if !errors.Is(err, domain.ErrInvalidInput) {
+			t.Errorf("%s: expected invalid input, got %v", seat, err)
+		}
+	}
+}
+
+func TestEngine_PricePools(t *testing.T) {
+	engine := pricing.NewEngine(pricing.Rules{
+		Currency: "EUR",
+		Tiers:    []pricing.TierRule{{Name: "early entry", Tier: "EARLY", Surcharge: 500}},
+		Fees:     []pricing.Fee{{Name: "service", Flat: 150}},
+	})
+	catalog := []pricing.Pool{
+		{ID: "floor", Price: domain.NewMoney(4000, "EUR")},
+		{ID: "floor-early", Tier: "EARLY", Price: domain.NewMoney(4000, "EUR")},
+	}
+
+	items, err := engine.PricePools(uuid.New(), catalog, []domain.PoolQuantity{{Pool: "floor", Quantity: 3}, {Pool: "floor-early", Quantity: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 40 + 1.50 fee per admission; early entry adds 5 before fees.
+	if items[0].Pool != "floor" || items[0].Quantity != 3 || items[0].SeatNo != "" || items[0].Price.Decimal() != "41.50" || items[0].Total().Decimal() != "124.50" {
+		t.Errorf("unexpected floor item %+v", items[0])
+	}
+	if items[1].Price.Decimal() != "46.50" || len(items[1].Breakdown) != 3 {
+		t.Errorf("unexpected early entry item %+v", items[1])
+	}
+
+	if _, err := engine.PricePools(uuid.New(), catalog, []domain.PoolQuantity{{Pool: "balcony", Quantity: 1}}); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("expected invalid input for an unknown pool, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package rateLimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery bounds how often idle buckets are dropped from the map.
+const sweepEvery = time.Minute
+
+type localBucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+// localLimiter is an in-process token bucket used while Redis is down. It
+// keeps no shared state, so the effective limit is per instance.
+type localLimiter struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	buckets   map[string]*localBucket
+	lastSweep time.Time
+}
+
+func newLocalLimiter(now func() time.Time) *localLimiter {
+	return &localLimiter{now: now, buckets: map[string]*localBucket{}, lastSweep: now()}
+}
+
+func (l *localLimiter) allow(key string, limit Limit) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepEvery {
+		l.sweep(now)
+	}
+
+	rate := float64(limit.Rate)
+	perSecond := rate / limit.Period.Seconds()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &localBucket{tokens: rate, last: now}
+		l.buckets[key] = b
+	}
+	b.period = limit.Period
+	b.tokens = math.Min(rate, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+
+	res := Result{Limit: limit.Rate}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - b.tokens) / perSecond)
+	}
+	res.Remaining = int(b.tokens)
+	res.ResetAfter = secondsToDuration((rate - b.tokens) / perSecond)
+	return res
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+func (l *localLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= b.period {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
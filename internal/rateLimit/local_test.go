@@ -0,0 +1,36 @@
+package rateLimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalLimiter(t *testing.T) {
+	now := time.Unix(1_760_000_000, 0)
+	l := newLocalLimiter(func() time.Time { return now })
+	limit := Limit{Rate: 3, Period: 3 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		if res := l.allow("k", limit); !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d: expected allowed with %d remaining, got %+v", i, 2-i, res)
+		}
+	}
+	res := l.allow("k", limit)
+	if res.Allowed || res.RetryAfter != time.Second {
+		t.Fatalf("expected rejection with 1s retry, got %+v", res)
+	}
+	if other := l.allow("other", limit); !other.Allowed {
+		t.Fatalf("expected buckets to be independent, got %+v", other)
+	}
+
+	now = now.Add(time.Second)
+	if res := l.allow("k", limit); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("expected one token refilled, got %+v", res)
+	}
+
+	now = now.Add(sweepEvery)
+	l.allow("k", limit)
+	if _, ok := l.buckets["other"]; ok {
+		t.Error("expected idle bucket to be swept")
+	}
+}
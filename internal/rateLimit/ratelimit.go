@@ -2,30 +2,97 @@ package rateLimit
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	redisadapter "github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/redis"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
 )
 
+type Algorithm string
+
+const (
+	SlidingWindow Algorithm = "sliding_window"
+	TokenBucket   Algorithm = "token_bucket"
+)
+
+// FailMode decides what happens to a request when Redis cannot be reached.
+type FailMode string
+
+const (
+	// FailClosed rejects the request with the Redis error.
+	FailClosed FailMode = "closed"
+	// FailOpen lets the request through unmetered.
+	FailOpen FailMode = "open"
+	// FailLocal meters the request with a per-process token bucket, so each
+	// instance enforces the limit on its own until Redis is back.
+	FailLocal FailMode = "local"
+)
+
+type Limit struct {
+	Rate      int
+	Period    time.Duration
+	Algorithm Algorithm
+	FailMode  FailMode
+}
+
 type RateLimiter struct {
-	redis *redisadapter.Cache
+	redis    *redisadapter.Cache
+	fallback *localLimiter
 }
 
-func NewRateLimiter(redis *redisadapter.Cache) *RateLimiter {
-	return &RateLimiter{redis: redis}
+// Result describes the state of a bucket after a request was counted
+// against it. ResetAfter is how long until the bucket is full again and
+// RetryAfter, for rejected requests, how long until one more is allowed.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
 }
 
-func (rl *RateLimiter) Allow(ctx context.Context, key string, rate int, period time.Duration) bool {
-	fullKey := "rl:" + key
+func NewRateLimiter(redis *redisadapter.Cache) *RateLimiter {
+	return &RateLimiter{redis: redis, fallback: newLocalLimiter(time.Now)}
+}
 
-	pipe := rl.redis.Client().Pipeline()
-	incr := pipe.Incr(ctx, fullKey)
-	pipe.Expire(ctx, fullKey, period)
+func (rl *RateLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.Algorithm == "" {
+		limit.Algorithm = SlidingWindow
+	}
+	var script *redis.Script
+	switch limit.Algorithm {
+	case SlidingWindow:
+		script = slidingWindowScript
+	case TokenBucket:
+		script = tokenBucketScript
+	default:
+		return Result{}, fmt.Errorf("unknown rate limit algorithm %q", limit.Algorithm)
+	}
 
-	_, err := pipe.Exec(ctx)
+	fullKey := "rl:" + string(limit.Algorithm) + ":" + key
+	vals, err := script.Run(ctx, rl.redis.Client(), []string{fullKey}, limit.Rate, limit.Period.Milliseconds()).Int64Slice()
 	if err != nil {
-		return false
+		observability.RateLimitBackendErrors.Inc()
+		switch limit.FailMode {
+		case FailOpen:
+			return Result{Allowed: true, Limit: limit.Rate, Remaining: limit.Rate, ResetAfter: limit.Period}, nil
+		case FailLocal:
+			return rl.fallback.allow(key, limit), nil
+		default:
+			return Result{}, err
+		}
 	}
 
-	return incr.Val() <= int64(rate)
+	res := Result{
+		Allowed:    vals[0] == 1,
+		Limit:      limit.Rate,
+		Remaining:  int(vals[1]),
+		ResetAfter: time.Duration(vals[2]) * time.Millisecond,
+	}
+	if !res.Allowed {
+		res.RetryAfter = time.Duration(vals[3]) * time.Millisecond
+	}
+	return res, nil
 }
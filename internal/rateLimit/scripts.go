@@ -0,0 +1,94 @@
+package rateLimit
+
+import "github.com/redis/go-redis/v9"
+
+// Both scripts read the clock from Redis so every API instance agrees on
+// window boundaries, and return {allowed, remaining, reset_ms, retry_ms}.
+
+// slidingWindowScript approximates a sliding log with two fixed windows: the
+// previous window's count is weighted by how much of it still overlaps the
+// sliding window ending now.
+//
+// KEYS[1] bucket hash; ARGV[1] limit; ARGV[2] period in ms.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local idx = math.floor(now / period)
+
+local state = redis.call("HMGET", KEYS[1], "idx", "cur", "prev")
+local cur = tonumber(state[2]) or 0
+local prev = tonumber(state[3]) or 0
+local stored = tonumber(state[1])
+if stored ~= idx then
+	if stored == idx - 1 then
+		prev = cur
+	else
+		prev = 0
+	end
+	cur = 0
+end
+
+local elapsed = now - idx * period
+local weight = (period - elapsed) / period
+local estimate = prev * weight + cur
+local allowed = 0
+local retry = 0
+if estimate + 1 <= limit then
+	allowed = 1
+	cur = cur + 1
+	estimate = estimate + 1
+elseif cur + 1 <= limit then
+	-- wait until the previous window has decayed enough
+	retry = math.ceil(period * (1 - (limit - 1 - cur) / prev)) - elapsed
+else
+	-- the current window alone is full; wait for it to become the previous one
+	retry = (period - elapsed) + math.ceil(period * (1 - (limit - 1) / cur))
+end
+
+redis.call("HSET", KEYS[1], "idx", idx, "cur", cur, "prev", prev)
+redis.call("PEXPIRE", KEYS[1], period * 2)
+
+local remaining = math.max(math.floor(limit - estimate), 0)
+local reset = period - elapsed
+if cur > 0 then
+	reset = reset + period
+end
+return {allowed, remaining, reset, math.max(retry, 1)}
+`)
+
+// tokenBucketScript refills limit tokens per period up to a capacity of
+// limit and spends one token per request.
+//
+// KEYS[1] bucket hash; ARGV[1] limit; ARGV[2] period in ms.
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local per_ms = limit / period
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = limit
+	ts = now
+end
+tokens = math.min(limit, tokens + math.max(now - ts, 0) * per_ms)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	allowed = 1
+	tokens = tokens - 1
+else
+	retry = math.ceil((1 - tokens) / per_ms)
+end
+
+local reset = math.ceil((limit - tokens) / per_ms)
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), reset, math.max(retry, 1)}
+`)
@@ -0,0 +1,310 @@
+package seating
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+)
+
+type Attribute string
+
+const (
+	Wheelchair     Attribute = "wheelchair"
+	Companion      Attribute = "companion"
+	RestrictedView Attribute = "restricted_view"
+	Aisle          Attribute = "aisle"
+)
+
+var knownAttributes = map[Attribute]bool{
+	Wheelchair: true, Companion: true, RestrictedView: true, Aisle: true,
+}
+
+// Chart is the seating chart of a venue layout. Seat numbers are unique
+// across the chart, since they become the seat numbers of every event that
+// uses it. Zone names a price zone; a seat without one takes its section's.
+type Chart struct {
+	Sections []Section `json:"sections"`
+}
+
+type Section struct {
+	Name string `json:"name"`
+	Zone string `json:"zone,omitempty"`
+	Rows []Row  `json:"rows"`
+}
+
+type Row struct {
+	Name  string `json:"name"`
+	Seats []Seat `json:"seats"`
+}
+
+// Seat coordinates are in the chart's own units, for drawing the seat map.
+type Seat struct {
+	Number     string      `json:"number"`
+	X          float64     `json:"x"`
+	Y          float64     `json:"y"`
+	Zone       string      `json:"zone,omitempty"`
+	Attributes []Attribute `json:"attributes,omitempty"`
+}
+
+func (c Chart) SeatCount() int {
+	n := 0
+	for _, section := range c.Sections {
+		for _, row := range section.Rows {
+			n += len(row.Seats)
+		}
+	}
+	return n
+}
+
+// Validate rejects charts without seats, unnamed sections or rows, repeated
+// seat numbers and unknown attributes.
+func (c Chart) Validate() error {
+	if c.SeatCount() == 0 {
+		return fmt.Errorf("%w: chart has no seats", domain.ErrInvalidInput)
+	}
+	seen := map[string]bool{}
+	for _, section := range c.Sections {
+		if section.Name == "" {
+			return fmt.Errorf("%w: section without a name", domain.ErrInvalidInput)
+		}
+		for _, row := range section.Rows {
+			if row.Name == "" {
+				return fmt.Errorf("%w: row without a name in section %s", domain.ErrInvalidInput, section.Name)
+			}
+			for _, seat := range row.Seats {
+				if seat.Number == "" {
+					return fmt.Errorf("%w: seat without a number in %s row %s", domain.ErrInvalidInput, section.Name, row.Name)
+				}
+				if seen[seat.Number] {
+					return fmt.Errorf("%w: seat %s appears twice", domain.ErrInvalidInput, seat.Number)
+				}
+				seen[seat.Number] = true
+				for _, attr := range seat.Attributes {
+					if !knownAttributes[attr] {
+						return fmt.Errorf("%w: seat %s has unknown attribute %q", domain.ErrInvalidInput, seat.Number, attr)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ParseJSON reads a chart in its JSON form.
+func ParseJSON(r io.Reader) (Chart, error) {
+	var chart Chart
+	if err := json.NewDecoder(r).Decode(&chart); err != nil {
+		return Chart{}, fmt.Errorf("%w: %v", domain.ErrInvalidInput, err)
+	}
+	return chart, chart.Validate()
+}
+
+var csvColumns = []string{"section", "row", "seat", "x", "y", "zone", "attributes"}
+
+// ParseCSV reads a chart with one seat per line under the header
+// section,row,seat,x,y,zone,attributes. Sections and rows keep the order
+// they first appear in; attributes are separated by "|". A zone given on
+// every seat of a section becomes the section's zone.
+func ParseCSV(r io.Reader) (Chart, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return Chart{}, fmt.Errorf("%w: missing header: %v", domain.ErrInvalidInput, err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"section", "row", "seat"} {
+		if _, ok := index[name]; !ok {
+			return Chart{}, fmt.Errorf("%w: missing column %q, expected %s", domain.ErrInvalidInput, name, strings.Join(csvColumns, ","))
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := index[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var chart Chart
+	sections := map[string]int{}
+	rows := map[[2]string]int{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Chart{}, fmt.Errorf("%w: %v", domain.ErrInvalidInput, err)
+		}
+
+		seat := Seat{Number: field(record, "seat"), Zone: field(record, "zone")}
+		for name, dst := range map[string]*float64{"x": &seat.X, "y": &seat.Y} {
+			if value := field(record, name); value != "" {
+				if *dst, err = strconv.ParseFloat(value, 64); err != nil {
+					return Chart{}, fmt.Errorf("%w: line %d: %s must be a number", domain.ErrInvalidInput, line, name)
+				}
+			}
+		}
+		for _, attr := range strings.Split(field(record, "attributes"), "|") {
+			if attr = strings.TrimSpace(attr); attr != "" {
+				seat.Attributes = append(seat.Attributes, Attribute(attr))
+			}
+		}
+
+		sectionName, rowName := field(record, "section"), field(record, "row")
+		s, ok := sections[sectionName]
+		if !ok {
+			s = len(chart.Sections)
+			sections[sectionName] = s
+			chart.Sections = append(chart.Sections, Section{Name: sectionName})
+		}
+		key := [2]string{sectionName, rowName}
+		r, ok := rows[key]
+		if !ok {
+			r = len(chart.Sections[s].Rows)
+			rows[key] = r
+			chart.Sections[s].Rows = append(chart.Sections[s].Rows, Row{Name: rowName})
+		}
+		chart.Sections[s].Rows[r].Seats = append(chart.Sections[s].Rows[r].Seats, seat)
+	}
+
+	for i := range chart.Sections {
+		liftSectionZone(&chart.Sections[i])
+	}
+	return chart, chart.Validate()
+}
+
+// liftSectionZone moves a zone shared by every seat of section up to the
+// section.
+func liftSectionZone(section *Section) {
+	zone := ""
+	for _, row := range section.Rows {
+		for _, seat := range row.Seats {
+			if seat.Zone == "" || (zone != "" && seat.Zone != zone) {
+				return
+			}
+			zone = seat.Zone
+		}
+	}
+	section.Zone = zone
+	for r := range section.Rows {
+		for s := range section.Rows[r].Seats {
+			section.Rows[r].Seats[s].Zone = ""
+		}
+	}
+}
+
+// PriceZone prices every seat in the zone, in minor units per currency.
+type PriceZone struct {
+	Name   string
+	Prices map[string]int64
+}
+
+// Override changes the seats of an event that match it: every seat of
+// Section, of Row within Section, or just Seats. Zone moves them to another
+// price zone and Available, when set, takes them on or off sale. Overrides
+// apply in order.
+type Override struct {
+	Section   string
+	Row       string
+	Seats     []string
+	Zone      string
+	Available *bool
+}
+
+// EventSeat is a chart seat as sold for one event.
+type EventSeat struct {
+	Number     string
+	Section    string
+	Row        string
+	X          float64
+	Y          float64
+	Zone       string
+	Attributes []Attribute
+	Prices     map[string]int64
+	Available  bool
+}
+
+// Apply lays the price zones and overrides of an event over chart. Every
+// seat left on sale must end up in one of zones. An override that matches
+// no seat is an error, as it is most likely a typo.
+func Apply(chart Chart, zones []PriceZone, overrides []Override) ([]EventSeat, error) {
+	prices := make(map[string]map[string]int64, len(zones))
+	for _, zone := range zones {
+		if zone.Name == "" {
+			return nil, fmt.Errorf("%w: price zone without a name", domain.ErrInvalidInput)
+		}
+		prices[zone.Name] = zone.Prices
+	}
+
+	var seats []EventSeat
+	for _, section := range chart.Sections {
+		for _, row := range section.Rows {
+			for _, seat := range row.Seats {
+				zone := seat.Zone
+				if zone == "" {
+					zone = section.Zone
+				}
+				seats = append(seats, EventSeat{
+					Number: seat.Number, Section: section.Name, Row: row.Name, X: seat.X, Y: seat.Y,
+					Zone: zone, Attributes: seat.Attributes, Available: true,
+				})
+			}
+		}
+	}
+
+	for i, o := range overrides {
+		matched := false
+		for s := range seats {
+			if !o.matches(seats[s]) {
+				continue
+			}
+			matched = true
+			if o.Zone != "" {
+				seats[s].Zone = o.Zone
+			}
+			if o.Available != nil {
+				seats[s].Available = *o.Available
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("%w: override %d matches no seat", domain.ErrInvalidInput, i+1)
+		}
+	}
+
+	for s := range seats {
+		zonePrices, ok := prices[seats[s].Zone]
+		if !ok && seats[s].Available {
+			return nil, fmt.Errorf("%w: seat %s is in zone %q, which has no prices", domain.ErrInvalidInput, seats[s].Number, seats[s].Zone)
+		}
+		seats[s].Prices = zonePrices
+	}
+	return seats, nil
+}
+
+func (o Override) matches(seat EventSeat) bool {
+	if o.Section != "" && o.Section != seat.Section {
+		return false
+	}
+	if o.Row != "" && o.Row != seat.Row {
+		return false
+	}
+	if len(o.Seats) > 0 {
+		for _, number := range o.Seats {
+			if number == seat.Number {
+				return true
+			}
+		}
+		return false
+	}
+	return o.Section != "" || o.Row != ""
+}
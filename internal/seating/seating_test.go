@@ -0,0 +1,143 @@
+package seating_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/seating"
+)
+
+func TestParseCSV(t *testing.T) {
+	chart, err := seating.ParseCSV(strings.NewReader(`section,row,seat,x,y,zone,attributes
+Stalls,A,A1,0,0,stalls,aisle
+Stalls,A,A2,1,0,stalls,
+Stalls,B,B1,0,1,stalls,wheelchair|companion
+Balcony,A,BA1,0,5,balcony,restricted_view
+Balcony,A,BA2,1,5,premium,
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := seating.Chart{Sections: []seating.Section{
+		{Name: "Stalls", Zone: "stalls", Rows: []seating.Row{
+			{Name: "A", Seats: []seating.Seat{
+				{Number: "A1", Attributes: []seating.Attribute{seating.Aisle}},
+				{Number: "A2", X: 1},
+			}},
+			{Name: "B", Seats: []seating.Seat{
+				{Number: "B1", Y: 1, Attributes: []seating.Attribute{seating.Wheelchair, seating.Companion}},
+			}},
+		}},
+		{Name: "Balcony", Rows: []seating.Row{
+			{Name: "A", Seats: []seating.Seat{
+				{Number: "BA1", Y: 5, Zone: "balcony", Attributes: []seating.Attribute{seating.RestrictedView}},
+				{Number: "BA2", X: 1, Y: 5, Zone: "premium"},
+			}},
+		}},
+	}}
+	if !reflect.DeepEqual(chart, want) {
+		t.Fatalf("got %+v, want %+v", chart, want)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func() (seating.Chart, error)
+	}{
+		{name: "csv missing column", parse: func() (seating.Chart, error) {
+			return seating.ParseCSV(strings.NewReader("section,seat\nStalls,A1\n"))
+		}},
+		{name: "csv bad coordinate", parse: func() (seating.Chart, error) {
+			return seating.ParseCSV(strings.NewReader("section,row,seat,x\nStalls,A,A1,left\n"))
+		}},
+		{name: "csv unknown attribute", parse: func() (seating.Chart, error) {
+			return seating.ParseCSV(strings.NewReader("section,row,seat,attributes\nStalls,A,A1,vip\n"))
+		}},
+		{name: "csv no seats", parse: func() (seating.Chart, error) {
+			return seating.ParseCSV(strings.NewReader("section,row,seat\n"))
+		}},
+		{name: "json duplicate seat", parse: func() (seating.Chart, error) {
+			return seating.ParseJSON(strings.NewReader(`{"sections":[{"name":"Stalls","rows":[
+				{"name":"A","seats":[{"number":"A1"}]},{"name":"B","seats":[{"number":"A1"}]}]}]}`))
+		}},
+		{name: "json unnamed row", parse: func() (seating.Chart, error) {
+			return seating.ParseJSON(strings.NewReader(`{"sections":[{"name":"Stalls","rows":[{"seats":[{"number":"A1"}]}]}]}`))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.parse(); !errors.Is(err, domain.ErrInvalidInput) {
+				t.Fatalf("expected ErrInvalidInput, got %v", err)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	chart := seating.Chart{Sections: []seating.Section{
+		{Name: "Stalls", Zone: "stalls", Rows: []seating.Row{
+			{Name: "A", Seats: []seating.Seat{{Number: "A1"}, {Number: "A2", Zone: "premium"}}},
+			{Name: "B", Seats: []seating.Seat{{Number: "B1"}, {Number: "B2"}}},
+		}},
+	}}
+	zones := []seating.PriceZone{
+		{Name: "stalls", Prices: map[string]int64{"EUR": 4000}},
+		{Name: "premium", Prices: map[string]int64{"EUR": 6000}},
+	}
+	off := false
+
+	t.Run("zones and overrides", func(t *testing.T) {
+		seats, err := seating.Apply(chart, zones, []seating.Override{
+			{Section: "Stalls", Row: "B", Zone: "premium"},
+			{Seats: []string{"B2"}, Available: &off},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]string{}
+		for _, seat := range seats {
+			got[seat.Number] = seat.Zone
+			if seat.Number == "B2" && seat.Available {
+				t.Fatal("B2 should be off sale")
+			}
+			if seat.Number != "B2" && !seat.Available {
+				t.Fatalf("%s should be on sale", seat.Number)
+			}
+		}
+		want := map[string]string{"A1": "stalls", "A2": "premium", "B1": "premium", "B2": "premium"}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("zones = %v, want %v", got, want)
+		}
+		if seats[2].Prices["EUR"] != 6000 || seats[2].Section != "Stalls" || seats[2].Row != "B" {
+			t.Fatalf("unexpected seat %+v", seats[2])
+		}
+	})
+
+	t.Run("unpriced seat off sale", func(t *testing.T) {
+		_, err := seating.Apply(chart, zones[:1], []seating.Override{{Seats: []string{"A2"}, Available: &off}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	for name, overrides := range map[string][]seating.Override{
+		"unpriced seat on sale":  nil,
+		"override matches none":  {{Section: "Balcony", Available: &off}},
+		"override without scope": {{Zone: "stalls"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			z := zones
+			if overrides == nil {
+				z = zones[:1]
+			}
+			if _, err := seating.Apply(chart, z, overrides); !errors.Is(err, domain.ErrInvalidInput) {
+				t.Fatalf("expected ErrInvalidInput, got %v", err)
+			}
+		})
+	}
+}
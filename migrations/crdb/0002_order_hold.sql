@@ -0,0 +1,8 @@
+SET database = tro;
+
+-- A hold owns one row per seat, so the hold id alone cannot be the key.
+-- Primary key columns must be NOT NULL, which seat_no was not declared as.
+ALTER TABLE holds ALTER COLUMN seat_no SET NOT NULL;
+ALTER TABLE holds DROP CONSTRAINT holds_pkey, ADD CONSTRAINT holds_pkey PRIMARY KEY (id, seat_no);
+
+ALTER TABLE orders ADD COLUMN hold_id UUID;
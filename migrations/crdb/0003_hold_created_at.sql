@@ -0,0 +1,3 @@
+SET database = tro;
+
+ALTER TABLE holds ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
@@ -0,0 +1,3 @@
+SET database = tro;
+
+ALTER TABLE order_items ADD COLUMN breakdown JSONB;
@@ -0,0 +1,5 @@
+SET database = tro;
+
+ALTER TABLE orders ADD COLUMN currency STRING(3) NOT NULL DEFAULT 'USD';
+
+ALTER TABLE order_items ADD COLUMN currency STRING(3) NOT NULL DEFAULT 'USD';
@@ -0,0 +1,19 @@
+SET database = tro;
+
+ALTER TABLE orders DROP CONSTRAINT check_status;
+
+ALTER TABLE orders ADD CONSTRAINT check_status CHECK (
+  status IN ('PENDING', 'AWAITING_PAYMENT', 'CONFIRMED', 'FAILED', 'CANCELLED', 'REFUNDED', 'EXPIRED')
+);
+
+ALTER TABLE orders ADD COLUMN updated_at TIMESTAMPTZ DEFAULT now();
+
+CREATE TABLE order_status_history (
+  id UUID PRIMARY KEY,
+  order_id UUID NOT NULL REFERENCES orders (id),
+  from_status TEXT NOT NULL,
+  to_status TEXT NOT NULL,
+  reason TEXT,
+  created_at TIMESTAMPTZ DEFAULT now(),
+  INDEX order_status_history_order_idx (order_id, created_at)
+);
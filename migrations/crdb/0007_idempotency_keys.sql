@@ -0,0 +1,16 @@
+SET database = tro;
+
+-- Durable copy of idempotency records. A row is written with committed = true
+-- in the same transaction as the business write it guards, so a key can never
+-- apply twice even if Redis loses it. Expired rows are removed by row-level TTL.
+CREATE TABLE idempotency_keys (
+  key STRING PRIMARY KEY,
+  fingerprint STRING NOT NULL,
+  token STRING,
+  committed BOOL NOT NULL DEFAULT false,
+  status INT,
+  header JSONB,
+  body BYTES,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL
+) WITH (ttl_expiration_expression = 'expires_at');
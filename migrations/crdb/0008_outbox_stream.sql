@@ -0,0 +1,7 @@
+SET database = tro;
+
+-- The availability stream tails hold and order events by creation time and
+-- resumes a client per event from the id it last saw.
+CREATE INDEX outbox_created_at_idx ON outbox (created_at, id);
+CREATE INDEX outbox_event_id_idx ON outbox ((payload_json->>'event_id'), created_at, id)
+  WHERE aggregate_type IN ('hold', 'order');
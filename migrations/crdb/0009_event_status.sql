@@ -0,0 +1,7 @@
+SET database = tro;
+
+-- Events are now written by the admin API. Rows that existed before were
+-- already selling, so they start out published.
+ALTER TABLE events ADD COLUMN status STRING NOT NULL DEFAULT 'PUBLISHED'
+  CHECK (status IN ('DRAFT', 'PUBLISHED', 'CANCELLED'));
+ALTER TABLE events ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
@@ -0,0 +1,18 @@
+SET database = tro;
+
+-- CockroachDB owns the sellable seats of an event; the catalog's available
+-- flag is projected from here. Seats dropped from an event but still
+-- referenced by past holds or orders stay, marked unsellable.
+ALTER TABLE seats ADD COLUMN sellable BOOL NOT NULL DEFAULT true;
+
+-- Seats that were held or sold before the inventory was enforced.
+INSERT INTO seats (event_id, seat_no)
+SELECT DISTINCT event_id, seat_no FROM holds
+UNION
+SELECT DISTINCT event_id, seat_no FROM order_items
+ON CONFLICT (event_id, seat_no) DO NOTHING;
+
+ALTER TABLE holds ADD CONSTRAINT holds_seat_fkey
+  FOREIGN KEY (event_id, seat_no) REFERENCES seats (event_id, seat_no);
+ALTER TABLE order_items ADD CONSTRAINT order_items_seat_fkey
+  FOREIGN KEY (event_id, seat_no) REFERENCES seats (event_id, seat_no);
@@ -0,0 +1,44 @@
+SET database = tro;
+
+-- General admission: a pool sells up to capacity admissions by quantity
+-- instead of named seats. What is taken is always counted from pool_holds
+-- and order_pool_items rather than kept in a counter, so expired holds and
+-- failed orders free their admissions without anything having to run.
+CREATE TABLE pools (
+  event_id UUID NOT NULL,
+  pool_id STRING NOT NULL,
+  capacity INT8 NOT NULL CHECK (capacity >= 0),
+  sellable BOOL NOT NULL DEFAULT true,
+  PRIMARY KEY (event_id, pool_id)
+);
+
+-- The pool part of a hold. A hold has seat rows in holds, pool rows here or
+-- both, all with the same id, user and expiry.
+CREATE TABLE pool_holds (
+  hold_id UUID NOT NULL,
+  event_id UUID NOT NULL,
+  pool_id STRING NOT NULL,
+  quantity INT8 NOT NULL CHECK (quantity > 0),
+  user_id UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  status STRING NOT NULL CHECK (status IN ('ACTIVE', 'EXPIRED', 'RELEASED')),
+  PRIMARY KEY (hold_id, pool_id),
+  CONSTRAINT pool_holds_pool_fkey FOREIGN KEY (event_id, pool_id) REFERENCES pools (event_id, pool_id),
+  INDEX pool_holds_active_idx (event_id, pool_id) STORING (quantity, expires_at) WHERE status = 'ACTIVE',
+  INDEX pool_holds_expiry_idx (expires_at) WHERE status = 'ACTIVE'
+);
+
+-- price is per admission, with its breakdown; the item costs price * quantity.
+CREATE TABLE order_pool_items (
+  order_id UUID NOT NULL,
+  event_id UUID NOT NULL,
+  pool_id STRING NOT NULL,
+  quantity INT8 NOT NULL CHECK (quantity > 0),
+  price NUMERIC NOT NULL,
+  currency STRING(3) NOT NULL,
+  breakdown JSONB,
+  PRIMARY KEY (order_id, event_id, pool_id),
+  CONSTRAINT order_pool_items_pool_fkey FOREIGN KEY (event_id, pool_id) REFERENCES pools (event_id, pool_id),
+  INDEX order_pool_items_pool_idx (event_id, pool_id) STORING (quantity)
+);
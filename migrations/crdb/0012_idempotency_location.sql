@@ -0,0 +1,5 @@
+SET database = tro;
+
+-- The resource a committed request created, so that a retry whose original
+-- response was lost can be pointed at it instead of being told to wait.
+ALTER TABLE idempotency_keys ADD COLUMN location STRING;
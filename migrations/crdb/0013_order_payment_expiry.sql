@@ -0,0 +1,5 @@
+SET database = tro;
+
+-- The expiry worker looks for orders that have been awaiting payment for
+-- longer than the payment timeout.
+CREATE INDEX orders_awaiting_payment_idx ON orders (updated_at) WHERE status = 'AWAITING_PAYMENT';
@@ -3,20 +3,26 @@ package integration_test
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	amqp "github.com/rabbitmq/amqp091-go"
 	redisclient "github.com/redis/go-redis/v9"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/crdb"
 	mongoadapter "github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/mongo"
-	"github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/rabbit"
 	redisadapter "github.com/robertarktes/ticket-reservations-and-orders/internal/adapters/redis"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/auth"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/config"
+	"github.com/robertarktes/ticket-reservations-and-orders/internal/domain"
 	httphandler "github.com/robertarktes/ticket-reservations-and-orders/internal/http"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/idempotency"
 	"github.com/robertarktes/ticket-reservations-and-orders/internal/observability"
@@ -70,19 +76,6 @@ func TestIntegration_HoldOrderConfirm(t *testing.T) {
 	}
 	defer redisContainer.Terminate(ctx)
 
-	rabbitContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
-		ContainerRequest: testcontainers.ContainerRequest{
-			Image:        "rabbitmq:3.13-management",
-			ExposedPorts: []string{"5672/tcp", "15672/tcp"},
-			WaitingFor:   wait.ForHTTP("/api/health").WithPort("15672"),
-		},
-		Started: true,
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer rabbitContainer.Terminate(ctx)
-
 	crdbHost, err := crdbContainer.Host(ctx)
 	if err != nil {
 		t.Fatal(err)
@@ -107,22 +100,16 @@ func TestIntegration_HoldOrderConfirm(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	rabbitHost, err := rabbitContainer.Host(ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	rabbitPort, err := rabbitContainer.MappedPort(ctx, "5672")
-	if err != nil {
-		t.Fatal(err)
-	}
 
 	cfg := &config.Config{
 		CRDBDSN:      "postgresql://root@" + crdbHost + ":" + crdbPort.Port() + "/tro?sslmode=disable",
 		MongoURI:     "mongodb://" + mongoHost + ":" + mongoPort.Port(),
 		RedisAddr:    redisHost + ":" + redisPort.Port(),
-		RabbitURL:    "amqp://guest:guest@" + rabbitHost + ":" + rabbitPort.Port() + "/",
 		HoldTTL:      300 * time.Second,
 		OTLPEndpoint: "", // Skip otel for test
+
+		PaymentWebhookSecrets:   []string{"test-webhook-secret"},
+		PaymentWebhookTolerance: time.Minute,
 	}
 
 	// Setup dependencies
@@ -131,7 +118,7 @@ func TestIntegration_HoldOrderConfirm(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer pool.Close()
-	crdbRepo := crdb.NewRepository(pool)
+	crdbRepo := crdb.NewRepository(pool, crdb.RetryPolicy{})
 
 	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI))
 	if err != nil {
@@ -141,31 +128,46 @@ func TestIntegration_HoldOrderConfirm(t *testing.T) {
 	mongoDB := mongoClient.Database("tro")
 	logger := observability.NewLogger()
 	mongoCatalog := mongoadapter.NewCatalogRepository(mongoDB, logger)
+	if err := mongoCatalog.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	auditLogger := mongoadapter.NewAuditLogger(mongoDB, logger)
 
 	redisClient := redisclient.NewClient(&redisclient.Options{Addr: cfg.RedisAddr})
 	redisCache := redisadapter.NewCache(redisClient)
 	redisIdemp := redisadapter.NewIdempotency(redisClient)
-	idemp := idempotency.NewIdempotency(redisIdemp, time.Hour)
+	idemp := idempotency.NewIdempotency(redisIdemp, crdb.NewIdempotencyStore(pool), time.Hour)
 	rl := rateLimit.NewRateLimiter(redisCache)
 
-	rabbitConn, err := amqp.Dial(cfg.RabbitURL)
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer rabbitConn.Close()
-	rabbitPub, err := rabbit.NewPublisher(rabbitConn)
+	pubDER, err := x509.MarshalPKIXPublicKey(&signingKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := auth.NewVerifier(auth.Options{
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})),
+		Issuer:    "tro-test",
+		Audience:  "tro-api",
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	handlers := httphandler.NewHandlers(cfg, crdbRepo, redisCache, idemp, mongoCatalog, rabbitPub)
-	r := httphandler.SetupRouter(handlers, logger, rl, idemp)
+	hub := httphandler.NewAvailabilityHub(crdbRepo, logger)
+	hubCtx, stopHub := context.WithCancel(ctx)
+	defer stopHub()
+	go hub.Run(hubCtx)
+	handlers := httphandler.NewHandlers(cfg, crdbRepo, redisCache, mongoCatalog, auditLogger, hub)
+	r := httphandler.SetupRouter(handlers, logger, verifier, rl, idemp)
 
 	// Start server
 	srv := &http.Server{Addr: ":8080", Handler: r}
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			t.Fatal(err)
+			t.Error(err)
 		}
 	}()
 	defer srv.Shutdown(ctx)
@@ -173,47 +175,74 @@ func TestIntegration_HoldOrderConfirm(t *testing.T) {
 	// Test scenario
 	eventID := uuid.New()
 	userID := uuid.New()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Subject:   userID.String(),
+		Issuer:    "tro-test",
+		Audience:  jwt.ClaimStrings{"tro-api"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	event := mongoadapter.EventDoc{
-		ID:   eventID,
-		Name: "Test Event",
+		ID:       eventID,
+		Name:     "Test Event",
+		Currency: "USD",
 		Seats: []mongoadapter.SeatDoc{
-			{Number: "A1", Row: "A", Section: "Main", Price: 0.0, Available: true},
+			{Number: "A1", Row: "A", Section: "Main", Prices: map[string]int64{"USD": 0}, Available: true},
+			{Number: "A2", Row: "A", Section: "Main", Prices: map[string]int64{"USD": 0}, Available: true},
+			{Number: "A3", Row: "A", Section: "Main", Prices: map[string]int64{"USD": 0}, Available: true},
 		},
 	}
 	err = mongoCatalog.CreateEvent(ctx, event)
 	if err != nil {
 		t.Fatal(err)
 	}
+	// CockroachDB owns the sellable seats; holds are checked against them.
+	err = crdbRepo.WithTx(ctx, func(tx pgx.Tx) error {
+		_, err := crdbRepo.SaveEvent(ctx, tx, domain.Event{
+			ID:     eventID,
+			Title:  event.Name,
+			Status: domain.EventPublished,
+			Seats:  []domain.EventSeat{{SeatNo: "A1", Sellable: true}, {SeatNo: "A2", Sellable: true}, {SeatNo: "A3", Sellable: true}},
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Test hold
 	holdReq := map[string]interface{}{
 		"event_id": eventID.String(),
 		"seats":    []string{"A1"},
-		"user_id":  userID.String(),
 	}
 	holdBody, _ := json.Marshal(holdReq)
 	req, _ := http.NewRequest("POST", "http://localhost:8080/v1/holds", bytes.NewReader(holdBody))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Idempotency-Key", uuid.New().String())
-	req.Header.Set("Authorization", "Bearer mock")
+	req.Header.Set("Authorization", "Bearer "+token)
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil || resp.StatusCode != http.StatusCreated {
 		t.Fatalf("hold failed: %v, status: %d", err, resp.StatusCode)
 	}
 
+	var holdResp struct {
+		HoldID uuid.UUID `json:"hold_id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&holdResp)
+
 	// Test order
 	orderReq := map[string]interface{}{
-		"event_id":       eventID.String(),
-		"seats":          []string{"A1"},
-		"user_id":        userID.String(),
+		"hold_id":        holdResp.HoldID.String(),
 		"payment_method": "card",
 	}
 	orderBody, _ := json.Marshal(orderReq)
 	req, _ = http.NewRequest("POST", "http://localhost:8080/v1/orders", bytes.NewReader(orderBody))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Idempotency-Key", uuid.New().String())
-	req.Header.Set("Authorization", "Bearer mock")
+	req.Header.Set("Authorization", "Bearer "+token)
 	resp, err = http.DefaultClient.Do(req)
 	if err != nil || resp.StatusCode != http.StatusAccepted {
 		t.Fatalf("order failed: %v, status: %d", err, resp.StatusCode)
@@ -224,6 +253,11 @@ func TestIntegration_HoldOrderConfirm(t *testing.T) {
 	}
 	json.NewDecoder(resp.Body).Decode(&orderResp)
 
+	// The order took the seat over from the hold, so its lock is gone.
+	if n, err := redisClient.Exists(ctx, "hold:{"+eventID.String()+"}:A1").Result(); err != nil || n != 0 {
+		t.Errorf("expected the seat lock to be released by the order, got %d %v", n, err)
+	}
+
 	// Test payment
 	paymentReq := map[string]interface{}{
 		"order_id":       orderResp.OrderID.String(),
@@ -231,16 +265,26 @@ func TestIntegration_HoldOrderConfirm(t *testing.T) {
 		"transaction_id": "tx123",
 	}
 	paymentBody, _ := json.Marshal(paymentReq)
+	for i := 0; i < 2; i++ { // the redelivery must be acknowledged without reapplying
+		req, _ = http.NewRequest("POST", "http://localhost:8080/v1/payments/callback", bytes.NewReader(paymentBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(httphandler.SignatureHeader, httphandler.SignPayload("test-webhook-secret", time.Now(), paymentBody))
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("payment failed: %v, status: %d", err, resp.StatusCode)
+		}
+	}
+
 	req, _ = http.NewRequest("POST", "http://localhost:8080/v1/payments/callback", bytes.NewReader(paymentBody))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err = http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		t.Fatalf("payment failed: %v, status: %d", err, resp.StatusCode)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unsigned payment should be rejected: %v, status: %d", err, resp.StatusCode)
 	}
 
 	// Verify order status
 	req, _ = http.NewRequest("GET", "http://localhost:8080/v1/orders/"+orderResp.OrderID.String(), nil)
-	req.Header.Set("Authorization", "Bearer mock")
+	req.Header.Set("Authorization", "Bearer "+token)
 	resp, err = http.DefaultClient.Do(req)
 	if err != nil || resp.StatusCode != http.StatusOK {
 		t.Fatalf("get order failed: %v, status: %d", err, resp.StatusCode)
@@ -252,4 +296,63 @@ func TestIntegration_HoldOrderConfirm(t *testing.T) {
 	if getOrderResp.Status != "CONFIRMED" {
 		t.Errorf("expected status CONFIRMED, got %s", getOrderResp.Status)
 	}
+
+	// Resending a hold that is gone must not touch the seat locks of a later
+	// hold of the same user on the same seat.
+	send := func(method, path string, body interface{}) *http.Response {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, "http://localhost:8080"+path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", uuid.New().String())
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	holdA2 := map[string]interface{}{"event_id": eventID.String(), "seats": []string{"A2"}}
+	var first, second struct {
+		HoldID uuid.UUID `json:"hold_id"`
+	}
+	json.NewDecoder(send("POST", "/v1/holds", holdA2).Body).Decode(&first)
+	if resp := send("DELETE", "/v1/holds/"+first.HoldID.String(), nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("release failed: status %d", resp.StatusCode)
+	}
+	json.NewDecoder(send("POST", "/v1/holds", holdA2).Body).Decode(&second)
+	if second.HoldID == uuid.Nil {
+		t.Fatal("second hold on A2 failed")
+	}
+	if resp := send("POST", "/v1/orders", map[string]interface{}{"hold_id": first.HoldID.String(), "payment_method": "card"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an order on a released hold to be refused, got status %d", resp.StatusCode)
+	}
+	if resp := send("DELETE", "/v1/holds/"+first.HoldID.String(), nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected releasing a released hold to be refused, got status %d", resp.StatusCode)
+	}
+	if owner, err := redisClient.Get(ctx, "hold:{"+eventID.String()+"}:A2").Result(); err != nil || owner != second.HoldID.String() {
+		t.Errorf("expected A2 to stay locked by the second hold, got %q %v", owner, err)
+	}
+
+	// A hold whose seat lock was taken by another hold while it lapsed in
+	// Redis is released rather than extended.
+	var third struct {
+		HoldID uuid.UUID `json:"hold_id"`
+	}
+	json.NewDecoder(send("POST", "/v1/holds", map[string]interface{}{"event_id": eventID.String(), "seats": []string{"A3"}}).Body).Decode(&third)
+	if third.HoldID == uuid.Nil {
+		t.Fatal("hold on A3 failed")
+	}
+	redisClient.Set(ctx, "hold:{"+eventID.String()+"}:A3", uuid.NewString(), time.Minute)
+	resp = send("PATCH", "/v1/holds/"+third.HoldID.String(), map[string]interface{}{"extend_by_seconds": 60})
+	var problem struct {
+		Code string `json:"code"`
+	}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	if resp.StatusCode != http.StatusConflict || problem.Code != "hold_lock_lost" {
+		t.Errorf("expected 409 hold_lock_lost, got %d %q", resp.StatusCode, problem.Code)
+	}
+	released, err := crdbRepo.GetHold(ctx, third.HoldID)
+	if err != nil || released.Status != "RELEASED" {
+		t.Errorf("expected the hold to be released, got %v %v", released, err)
+	}
 }